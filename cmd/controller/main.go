@@ -0,0 +1,127 @@
+package main
+
+import (
+	goflag "flag"
+	"net/http"
+	"os"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/apis/v1alpha1"
+	"github.com/meln5674/k8s-smoke-test/pkg/controller"
+	"github.com/meln5674/k8s-smoke-test/pkg/release"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+var (
+	metricsAddress          = flag.String("metrics-bind-address", ":8080", "Address to serve controller metrics on")
+	probeAddress            = flag.String("health-probe-bind-address", ":8081", "Address to serve health probes on")
+	leaderElect             = flag.Bool("leader-elect", false, "Use leader election, so that only one replica of the controller is active at once")
+	chartPath               = flag.String("chart", "", "Path to the chart to install. If not set, the chart built into this tool is used")
+	installTimeout          = flag.Duration("timeout", release.DefaultTimeout, "How long to wait for a release to be ready, or to be deleted")
+	checkTimeout            = flag.Duration("check-timeout", 5*time.Minute, "How long each attempt of a check may take before it fails, or 0 for no limit")
+	maxConcurrentReconciles = flag.Int("max-concurrent-reconciles", controller.DefaultMaxConcurrentReconciles, "Maximum number of SmokeTests to deploy, test, or uninstall at once. As the checks are run synchronously, this is also how many slow SmokeTests it takes to delay every other")
+)
+
+var (
+	scheme  = runtime.NewScheme()
+	zapOpts = zap.Options{}
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+
+	goFlags := goflag.NewFlagSet("zap", goflag.ExitOnError)
+	zapOpts.BindFlags(goFlags)
+	flag.CommandLine.AddGoFlagSet(goFlags)
+}
+
+func main() {
+	flag.Parse()
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
+	setupLog := ctrl.Log.WithName("setup")
+
+	err := run()
+	if err != nil {
+		setupLog.Error(err, "Controller failed")
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	// The same loading rules as kubectl, falling back to the in-cluster config
+	clientConfigLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{},
+	)
+	restConfig, err := clientConfigLoader.ClientConfig()
+	if err != nil {
+		return err
+	}
+	k8sClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	installer := &controller.HelmInstaller{
+		Getter:    release.NewRESTClientGetter(clientConfigLoader),
+		K8sClient: k8sClient,
+		Timeout:   *installTimeout,
+	}
+	if *chartPath != "" {
+		installer.Chart, err = loader.Load(*chartPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: *metricsAddress},
+		HealthProbeBindAddress: *probeAddress,
+		LeaderElection:         *leaderElect,
+		LeaderElectionID:       "k8s-smoke-test.meln5674.github.io",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = (&controller.SmokeTestReconciler{
+		Client:    mgr.GetClient(),
+		Installer: installer,
+		Config: test.Config{
+			HTTP:         &http.Client{},
+			K8sConfig:    restConfig,
+			CheckTimeout: *checkTimeout,
+		},
+		MaxConcurrentReconciles: *maxConcurrentReconciles,
+	}).SetupWithManager(mgr)
+	if err != nil {
+		return err
+	}
+
+	err = mgr.AddHealthzCheck("healthz", healthz.Ping)
+	if err != nil {
+		return err
+	}
+	err = mgr.AddReadyzCheck("readyz", healthz.Ping)
+	if err != nil {
+		return err
+	}
+
+	return mgr.Start(ctrl.SetupSignalHandler())
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/dns"
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+	"github.com/meln5674/k8s-smoke-test/pkg/probe"
+)
+
+var (
+	listen      = flag.String("listen", "0.0.0.0:8080", "Address to listen on")
+	enableProbe = flag.Bool("enable-probe", false, "Serve /probe, which connects to other pods and Services on behalf of the client, as used by the connectivity-matrix check")
+)
+
+func healthcheck(w http.ResponseWriter, req *http.Request) {
+	log.Printf("%s %s", req.Method, req.URL.String())
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func main() {
+	flag.Parse()
+
+	pod := echo.PodInfoFromEnv()
+	http.HandleFunc("/health", healthcheck)
+	http.HandleFunc("/dns", dns.Handler)
+	http.HandleFunc("/echo", echo.Handler(pod))
+	if *enableProbe {
+		http.HandleFunc("/probe", probe.Handler(pod))
+	}
+
+	http.ListenAndServe(*listen, nil)
+}
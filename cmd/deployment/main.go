@@ -6,6 +6,9 @@ import (
 	"strings"
 
 	flag "github.com/spf13/pflag"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/dns"
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
 )
 
 var (
@@ -46,6 +49,8 @@ func main() {
 	flag.Parse()
 
 	http.HandleFunc("/health", healthcheck)
+	http.HandleFunc("/dns", dns.Handler)
+	http.HandleFunc("/echo", echo.Handler(echo.PodInfoFromEnv()))
 	http.HandleFunc("/rwx/", handleRWXRequest(http.FileServer(http.Dir(*rwxVolumeMount))))
 
 	http.ListenAndServe(*listen, nil)
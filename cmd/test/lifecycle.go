@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/release"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+var (
+	chartPath       = flag.String("chart", "", "Path to the chart to install. If not set, the chart built into this tool is used")
+	valuesOpts      values.Options
+	installTimeout  = flag.Duration("timeout", release.DefaultTimeout, "How long to wait for the release to be ready, or to be deleted")
+	createNamespace = flag.Bool("create-namespace", false, "Create the release namespace if it does not exist")
+	keepPVCs        = flag.Bool("keep-pvcs", false, "Do not delete the PVCs of the release when uninstalling")
+	keepOnFailure   = flag.Bool("keep-on-failure", false, "Do not uninstall the release in up-test-down if the test fails, so that it can be inspected")
+)
+
+func init() {
+	flag.StringSliceVarP(&valuesOpts.ValueFiles, "values", "f", nil, "Values files to install the chart with")
+	flag.StringArrayVar(&valuesOpts.Values, "set", nil, "Values to install the chart with, in helm --set syntax")
+	flag.StringArrayVar(&valuesOpts.StringValues, "set-string", nil, "String values to install the chart with, in helm --set-string syntax")
+}
+
+// helmEnv is the common setup for subcommands that use the helm SDK
+type helmEnv struct {
+	namespace    string
+	actionConfig *action.Configuration
+	k8sClient    *kubernetes.Clientset
+	opts         *release.Options
+}
+
+func newHelmEnv() (*helmEnv, error) {
+	loader := clientConfigLoader()
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, err
+	}
+	clientConfig, err := loadClientConfig(loader)
+	if err != nil {
+		return nil, err
+	}
+	k8sClient, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	actionConfig, err := release.NewActionConfig(release.NewRESTClientGetter(loader), namespace)
+	if err != nil {
+		return nil, err
+	}
+	chrt, err := loadChart()
+	if err != nil {
+		return nil, err
+	}
+	vals, err := valuesOpts.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse values")
+	}
+	return &helmEnv{
+		namespace:    namespace,
+		actionConfig: actionConfig,
+		k8sClient:    k8sClient,
+		opts: &release.Options{
+			Namespace:       namespace,
+			ReleaseName:     *releaseName,
+			Chart:           chrt,
+			Values:          vals,
+			Timeout:         *installTimeout,
+			CreateNamespace: *createNamespace,
+			KeepPVCs:        *keepPVCs,
+		},
+	}, nil
+}
+
+func loadChart() (*chart.Chart, error) {
+	if *chartPath == "" {
+		return release.LoadEmbeddedChart()
+	}
+	return loader.Load(*chartPath)
+}
+
+func install(ctx context.Context) error {
+	env, err := newHelmEnv()
+	if err != nil {
+		return err
+	}
+	_, err = release.Install(ctx, env.actionConfig, env.opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Release %s is ready", *releaseName)
+	return nil
+}
+
+func uninstall(ctx context.Context) error {
+	env, err := newHelmEnv()
+	if err != nil {
+		return err
+	}
+	return release.Uninstall(ctx, env.actionConfig, env.k8sClient, env.opts)
+}
+
+func upTestDown(ctx context.Context) (err error) {
+	env, err := newHelmEnv()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && *keepOnFailure {
+			log.Printf("Keeping release %s for inspection", *releaseName)
+			return
+		}
+		uninstallErr := release.Uninstall(ctx, env.actionConfig, env.k8sClient, env.opts)
+		if err == nil {
+			err = uninstallErr
+		} else if uninstallErr != nil {
+			log.Println(uninstallErr)
+		}
+	}()
+
+	rel, err := release.Install(ctx, env.actionConfig, env.opts)
+	if err != nil {
+		return err
+	}
+	vals, err := release.MergedValues(rel)
+	if err != nil {
+		return err
+	}
+	mergedValues, err := test.ParseMergedValues(vals)
+	if err != nil {
+		return errors.Wrap(err, "Failed to parse values of installed release")
+	}
+	clientConfig, err := loadClientConfig(clientConfigLoader())
+	if err != nil {
+		return err
+	}
+	return runTest(ctx, clientConfig, env.namespace, mergedValues)
+}
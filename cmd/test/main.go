@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
+	"time"
 
+	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/meln5674/k8s-smoke-test/pkg/test"
@@ -16,61 +22,274 @@ import (
 
 var (
 	releaseName          = flag.String("release-name", "k8s-smoke-test", "Name of the release")
-	mergedValuesPath     = flag.String("merged-values-json", "-", "Path to the merged helm values, in JSON format, or `-` for STDIN")
+	mergedValuesPath     = flag.String("merged-values-json", "", "Path to the merged helm values, in JSON format, or `-` for STDIN. If not set, they are read from the helm release secret")
 	kubeconfig           = flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "Path to the kubeconfig file to use for CLI requests.")
-	portForwardLocalPort = flag.Int("port-forward-local-port", 8080, "Local port to use when testing port-forwarding")
+	portForwardLocalPort = flag.Int("port-forward-local-port", 8080, "Local port to use when testing port-forwarding, or 0 to use any free port")
+	portForwardAll       = flag.Bool("port-forward-all-replicas", false, "Test port-forwarding to every pod of the Deployment in turn, instead of just one")
+	perNode              = flag.Bool("per-node", false, "Run the port-forward and logs checks against one pod of the deployment on each node, instead of just one pod")
+	ingressHostname      = flag.String("ingress-hostname", "", "Hostname or IP to put in the URL when testing the ingress, instead of deployment.ingress.hostname, which is still sent as the Host header and TLS server name")
+	ingressTLS           = flag.Bool("ingress-tls", false, "Use HTTPS when testing the ingress, even if deployment.ingress.tls is empty")
+	ingressAddress       = flag.String("ingress-address", "", "IP or hostname, with optional port, to connect to when testing the ingress, without changing the URL, Host header, or TLS server name. Has no effect when using a proxy")
+	ingressCompareSecret = flag.Bool("ingress-tls-compare-secret", false, "Require the certificate served by the ingress to be the one in the secret referenced by deployment.ingress.tls")
+	ingressForwarded     = flag.Bool("ingress-require-forwarded-headers", false, "Fail the ingress-echo check if the ingress controller does not set X-Forwarded-For or Forwarded on the request")
+	sourceIP             = flag.String("source-ip", "", "IP the pods should observe as the client IP in the loadbalancer-source-ip and nodeport-local checks. If not set, the local IP used to reach the cluster is expected, which is wrong if there is NAT in between")
+	nodeAddressType      = flag.String("node-address-type", string(corev1.NodeInternalIP), "Type of node address to connect to in the nodeport-local check, e.g. InternalIP or ExternalIP")
+	reportFormat         = flag.String("report-format", "", fmt.Sprintf("If set, write a report of each check in this format, one of %v", test.ReportFormats))
+	reportFile           = flag.String("report-file", "-", "Path to write the report to, or `-` for STDOUT")
+	only                 = flag.StringSlice("only", nil, "If set, only execute the checks with these names")
+	skip                 = flag.StringSlice("skip", nil, "Do not execute the checks with these names")
+	waitTimeout          = flag.Duration("wait-timeout", 0, "If set, wait up to this long for the deployment, statefulset, job, PVCs, ingress and load balancer of the release to be ready before executing any checks")
+	retryAttempts        = flag.Int("retry-attempts", 1, "Maximum number of times to execute each check before it is considered failed")
+	retryInitialBackoff  = flag.Duration("retry-initial-backoff", 5*time.Second, "How long to wait after the first failed attempt of a check. Doubles after each subsequent failed attempt")
+	retryMaxElapsed      = flag.Duration("retry-max-elapsed", 0, "If set, do not start another attempt of a check this long after its first attempt started")
+	checkRetry           = flag.StringToString("check-retry", nil, "Retry policies for individual checks, as name=attempts[/initialBackoff[/maxElapsed]], e.g. ingress=10/5s/2m. Omitted fields default to the --retry-* flags")
+	checkTimeout         = flag.Duration("check-timeout", 5*time.Minute, "How long each attempt of a check may take before it fails, or 0 for no limit")
+	checkTimeouts        = flag.StringToString("check-timeouts", nil, "Timeouts for individual checks, as name=duration, e.g. logs=30s, overriding --check-timeout")
+	logsMaxBytes         = flag.Int64("logs-max-bytes", 0, "Maximum number of bytes of each pod's logs to read in the logs check, or 0 for no limit")
+	logsMaxDuration      = flag.Duration("logs-max-duration", 30*time.Second, "How long to read each pod's logs for in the logs check before stopping, or 0 for no limit")
+	parallelism          = flag.Int("parallelism", 1, "Maximum number of checks to execute at once. Checks still wait for the checks they depend on")
+	continueOnFailure    = flag.Bool("continue-on-failure", false, "Continue executing checks after one fails, instead of stopping at the first failure")
+	events               = flag.String("events", string(test.EventsOff), fmt.Sprintf("What to do if a warning event with one of --event-reasons involves the release while the checks execute, one of %v", test.EventsModes))
+	eventReasons         = flag.StringSlice("event-reasons", test.DefaultEventReasons, "Reasons of warning events to fail or warn on")
+	diagnosticsFile      = flag.String("diagnostics-file", "", "If set and any check fails, write a gzipped tarball of pod descriptions, logs, events, and HTTP response headers to this path")
 	kubernetesOverrides  clientcmd.ConfigOverrides
+	httpOptions          test.HTTPOptions
 )
 
+// commands are the subcommands of this tool. If no subcommand is given, "run" is assumed.
+var commands = map[string]func(ctx context.Context) error{
+	"install":      install,
+	"run":          run,
+	"uninstall":    uninstall,
+	"up-test-down": upTestDown,
+}
+
+var command = "run"
+
 func init() {
+	if len(os.Args) > 1 {
+		if _, ok := commands[os.Args[1]]; ok {
+			command = os.Args[1]
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [install|run|uninstall|up-test-down] [flags]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "  install       Install or upgrade the chart, and wait for it to be ready")
+		fmt.Fprintln(os.Stderr, "  run           Test an already-installed release (default)")
+		fmt.Fprintln(os.Stderr, "  uninstall     Uninstall the release and delete its PVCs")
+		fmt.Fprintln(os.Stderr, "  up-test-down  Install, test, then uninstall")
+		flag.PrintDefaults()
+	}
 	clientcmd.BindOverrideFlags(&kubernetesOverrides, flag.CommandLine, clientcmd.RecommendedConfigOverrideFlags(""))
+	// These are prefixed to not conflict with the kubectl flags for the API server
+	flag.StringVar(&httpOptions.CAFile, "http-certificate-authority", "", "Path to a PEM bundle of additional CAs to trust when testing the ingress, NodePort and LoadBalancer")
+	flag.StringVar(&httpOptions.ClientCertFile, "http-client-certificate", "", "Path to a PEM client certificate to present when testing the ingress, NodePort and LoadBalancer")
+	flag.StringVar(&httpOptions.ClientKeyFile, "http-client-key", "", "Path to the PEM private key for --http-client-certificate")
+	flag.StringVar(&httpOptions.ServerName, "http-tls-server-name", "", "Server name to use for SNI and certificate verification when testing the ingress, NodePort and LoadBalancer")
+	flag.BoolVar(&httpOptions.InsecureSkipVerify, "http-insecure-skip-tls-verify", false, "Do not verify server certificates when testing the ingress, NodePort and LoadBalancer")
 	flag.Parse()
 }
 
 func main() {
 	ctx := context.Background()
-	var err error
-	mergedValuesStream := os.Stdin
-	if *mergedValuesPath != "-" {
-		mergedValuesStream, err = os.Open(*mergedValuesPath)
+	if *reportFormat != "" {
+		// Fail fast instead of after running the whole test
+		err := (&test.Report{}).Write(io.Discard, test.ReportFormat(*reportFormat))
 		if err != nil {
 			log.Fatal(err)
 		}
-		defer mergedValuesStream.Close()
 	}
-	var mergedValues test.MergedValues
-	err = json.NewDecoder(mergedValuesStream).Decode(&mergedValues)
+	err := commands[command](ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	clientConfigLoader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+// clientConfigLoader loads the kubeconfig from --kubeconfig, or the in-cluster config of the pod's ServiceAccount if it is not set.
+// The namespace defaults to the pod's namespace when running in-cluster.
+func clientConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		&clientcmd.ClientConfigLoadingRules{
 			ExplicitPath: *kubeconfig,
 		},
 		&kubernetesOverrides,
 	)
+}
+
+// loadClientConfig is like loader.ClientConfig(), but explicitly falls back to rest.InClusterConfig() if no kubeconfig was provided
+func loadClientConfig(loader clientcmd.ClientConfig) (*rest.Config, error) {
+	clientConfig, err := loader.ClientConfig()
+	if err == nil {
+		return clientConfig, nil
+	}
+	if !clientcmd.IsEmptyConfig(err) {
+		return nil, err
+	}
+	clientConfig, inClusterErr := rest.InClusterConfig()
+	if inClusterErr != nil {
+		return nil, errors.Wrapf(inClusterErr, "No kubeconfig was provided with --kubeconfig or KUBECONFIG, and the in-cluster config could not be loaded")
+	}
+	log.Println("No kubeconfig was provided, using in-cluster config")
+	return clientConfig, nil
+}
 
-	namespace, _, err := clientConfigLoader.Namespace()
+func run(ctx context.Context) error {
+	loader := clientConfigLoader()
+
+	namespace, _, err := loader.Namespace()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	clientConfig, err := clientConfigLoader.ClientConfig()
+	clientConfig, err := loadClientConfig(loader)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	err = test.Test(ctx, &test.Config{
-		HTTP:                 http.DefaultClient,
-		K8sConfig:            clientConfig,
-		ReleaseNamespace:     namespace,
-		ReleaseName:          *releaseName,
-		MergedValues:         &mergedValues,
-		PortForwardLocalPort: *portForwardLocalPort,
-	})
+	mergedValues, err := loadMergedValues(ctx, clientConfig, namespace)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	if *watch {
+		return watchTest(ctx, clientConfig, namespace, mergedValues)
+	}
+	return runTest(ctx, clientConfig, namespace, mergedValues)
+}
+
+// testConfig builds the configuration for a test from the flags
+func testConfig(clientConfig *rest.Config, namespace string, mergedValues *test.MergedValues) (*test.Config, error) {
+	httpClient, err := httpOptions.Client()
+	if err != nil {
+		return nil, err
+	}
+	retry := test.RetryPolicy{
+		Attempts:       *retryAttempts,
+		InitialBackoff: *retryInitialBackoff,
+		MaxElapsed:     *retryMaxElapsed,
+	}
+	checkRetryPolicies := make(map[string]test.RetryPolicy, len(*checkRetry))
+	for name, policy := range *checkRetry {
+		checkRetryPolicies[name], err = test.ParseRetryPolicy(policy, retry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid --check-retry for %s", name)
+		}
+	}
+	checkTimeoutDurations := make(map[string]time.Duration, len(*checkTimeouts))
+	for name, timeout := range *checkTimeouts {
+		checkTimeoutDurations[name], err = time.ParseDuration(timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid --check-timeouts for %s", name)
+		}
+	}
+	return &test.Config{
+		HTTP:                           httpClient,
+		K8sConfig:                      clientConfig,
+		ReleaseNamespace:               namespace,
+		ReleaseName:                    *releaseName,
+		MergedValues:                   mergedValues,
+		PortForwardLocalPort:           *portForwardLocalPort,
+		PortForwardAllReplicas:         *portForwardAll,
+		PerNode:                        *perNode,
+		IngressHostname:                *ingressHostname,
+		IngressTLS:                     *ingressTLS,
+		IngressAddress:                 *ingressAddress,
+		IngressTLSCompareSecret:        *ingressCompareSecret,
+		IngressRequireForwardedHeaders: *ingressForwarded,
+		SourceIP:                       *sourceIP,
+		NodeAddressType:                corev1.NodeAddressType(*nodeAddressType),
+		WaitTimeout:                    *waitTimeout,
+		Retry:                          retry,
+		CheckRetry:                     checkRetryPolicies,
+		CheckTimeout:                   *checkTimeout,
+		CheckTimeouts:                  checkTimeoutDurations,
+		LogsMaxBytes:                   *logsMaxBytes,
+		LogsMaxDuration:                *logsMaxDuration,
+		Only:                           *only,
+		Skip:                           *skip,
+		Parallelism:                    *parallelism,
+		ContinueOnFailure:              *continueOnFailure,
+		Events:                         test.EventsMode(*events),
+		EventReasons:                   *eventReasons,
+		DiagnosticsPath:                *diagnosticsFile,
+	}, nil
+}
+
+func runTest(ctx context.Context, clientConfig *rest.Config, namespace string, mergedValues *test.MergedValues) error {
+	cfg, err := testConfig(clientConfig, namespace, mergedValues)
+	if err != nil {
+		return err
+	}
+	report, err := test.Test(ctx, cfg)
+	logReport(report)
+	if *reportFormat != "" {
+		writeErr := writeReport(report)
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	if err != nil {
+		return err
 	}
 	log.Println("PASSED")
+	return nil
+}
+
+// logReport logs the outcome of each check
+func logReport(report *test.Report) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case test.StatusFailed:
+			log.Printf("%s: %s (%s): %s", result.Name, result.Status, result.Duration, result.Error)
+		case test.StatusSkipped:
+			log.Printf("%s: %s: %s", result.Name, result.Status, result.SkipReason)
+		default:
+			log.Printf("%s: %s (%s)", result.Name, result.Status, result.Duration)
+		}
+	}
+	if report.DiagnosticsPath != "" {
+		log.Printf("Wrote diagnostics to %s", report.DiagnosticsPath)
+	}
+}
+
+func loadMergedValues(ctx context.Context, clientConfig *rest.Config, namespace string) (*test.MergedValues, error) {
+	if *mergedValuesPath == "" {
+		k8sClient, err := kubernetes.NewForConfig(clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		return test.GetMergedValues(ctx, k8sClient, namespace, *releaseName)
+	}
+	mergedValuesStream := os.Stdin
+	if *mergedValuesPath != "-" {
+		var err error
+		mergedValuesStream, err = os.Open(*mergedValuesPath)
+		if err != nil {
+			return nil, err
+		}
+		defer mergedValuesStream.Close()
+	}
+	var mergedValues test.MergedValues
+	err := json.NewDecoder(mergedValuesStream).Decode(&mergedValues)
+	if err != nil {
+		return nil, err
+	}
+	return &mergedValues, nil
+}
+
+func writeReport(report *test.Report) error {
+	if *reportFile == "-" {
+		return report.Write(os.Stdout, test.ReportFormat(*reportFormat))
+	}
+	f, err := os.Create(*reportFile)
+	if err != nil {
+		return err
+	}
+	err = report.Write(f, test.ReportFormat(*reportFormat))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return errors.Wrap(f.Close(), "Failed to write report")
 }
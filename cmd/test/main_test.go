@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var _ = Describe("loadClientConfig", func() {
+	It("should load the kubeconfig when one is provided", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+		kubeconfig := clientcmdapi.NewConfig()
+		kubeconfig.Clusters["test"] = &clientcmdapi.Cluster{Server: "https://k8s.example.com:6443"}
+		kubeconfig.AuthInfos["test"] = &clientcmdapi.AuthInfo{Token: "token"}
+		kubeconfig.Contexts["test"] = &clientcmdapi.Context{Cluster: "test", AuthInfo: "test", Namespace: "smoke"}
+		kubeconfig.CurrentContext = "test"
+		Expect(clientcmd.WriteToFile(*kubeconfig, path)).To(Succeed())
+
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+			&clientcmd.ConfigOverrides{},
+		)
+		clientConfig, err := loadClientConfig(loader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientConfig.Host).To(Equal("https://k8s.example.com:6443"))
+		Expect(clientConfig.BearerToken).To(Equal("token"))
+	})
+
+	It("should fall back to the in-cluster config when no kubeconfig is provided", func() {
+		// Outside of a pod, the in-cluster config cannot be loaded, so this only proves the fallback was attempted
+		GinkgoT().Setenv("KUBERNETES_SERVICE_HOST", "")
+		GinkgoT().Setenv("KUBERNETES_SERVICE_PORT", "")
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{},
+			&clientcmd.ConfigOverrides{},
+		)
+		_, err := loadClientConfig(loader)
+		Expect(err).To(MatchError(ContainSubstring("the in-cluster config could not be loaded")))
+	})
+
+	It("should not fall back to the in-cluster config when the kubeconfig is invalid", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "kubeconfig")
+		Expect(os.WriteFile(path, []byte("not: [a kubeconfig"), 0600)).To(Succeed())
+		loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+			&clientcmd.ConfigOverrides{},
+		)
+		_, err := loadClientConfig(loader)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).ToNot(ContainSubstring("in-cluster"))
+	})
+})
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/monitor"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+var (
+	watch          = flag.Bool("watch", false, "Repeat the test forever instead of exiting, and serve Prometheus metrics of the outcomes")
+	watchInterval  = flag.Duration("interval", time.Minute, "How often to start a test with --watch")
+	metricsAddress = flag.String("metrics-address", ":9090", "Address to serve Prometheus metrics on at /metrics with --watch")
+)
+
+func watchTest(ctx context.Context, clientConfig *rest.Config, namespace string, mergedValues *test.MergedValues) error {
+	cfg, err := testConfig(clientConfig, namespace, mergedValues)
+	if err != nil {
+		return err
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	metrics := monitor.NewMetrics(reg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: *metricsAddress, Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving metrics on %s/metrics", *metricsAddress)
+		serverErr <- server.ListenAndServe()
+	}()
+	defer server.Close()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- monitor.Watch(watchCtx, cfg, *watchInterval, metrics, func(report *test.Report, err error) {
+			logReport(report)
+			if *reportFormat != "" {
+				writeErr := writeReport(report)
+				if writeErr != nil {
+					log.Println(writeErr)
+				}
+			}
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			log.Println("PASSED")
+		})
+	}()
+
+	select {
+	case err = <-serverErr:
+		return err
+	case err = <-watchErr:
+		return err
+	}
+}
@@ -0,0 +1,14 @@
+// Package helm embeds the k8s-smoke-test helm chart so that it can be installed without a copy of this repository
+package helm
+
+import (
+	"embed"
+)
+
+// ChartDir is the directory within ChartFS containing the chart
+const ChartDir = "k8s-smoke-test"
+
+// ChartFS contains the k8s-smoke-test chart
+//
+//go:embed all:k8s-smoke-test
+var ChartFS embed.FS
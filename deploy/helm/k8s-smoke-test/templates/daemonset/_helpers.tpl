@@ -0,0 +1,21 @@
+
+{{- define "k8s-smoke-test.daemonset.extraLabels" -}}
+app.kubernetes.io/component: daemonset
+{{- end -}}
+
+{{/*
+Common labels
+*/}}
+{{- define "k8s-smoke-test.daemonset.labels" -}}
+{{ include "k8s-smoke-test.labels" . }}
+{{ include "k8s-smoke-test.daemonset.extraLabels" . }}
+
+{{- end }}
+
+{{/*
+Selector labels
+*/}}
+{{- define "k8s-smoke-test.daemonset.selectorLabels" -}}
+{{ include "k8s-smoke-test.selectorLabels" . }}
+{{ include "k8s-smoke-test.daemonset.extraLabels" . }}
+{{- end }}
@@ -0,0 +1,20 @@
+
+{{- define "k8s-smoke-test.test.extraLabels" -}}
+app.kubernetes.io/component: test
+{{- end -}}
+
+{{/*
+Common labels
+*/}}
+{{- define "k8s-smoke-test.test.labels" -}}
+{{ include "k8s-smoke-test.labels" . }}
+{{ include "k8s-smoke-test.test.extraLabels" . }}
+
+{{- end }}
+
+{{/*
+Name of the service account, role, and role binding for the test CronJob
+*/}}
+{{- define "k8s-smoke-test.test.name" -}}
+{{ include "k8s-smoke-test.fullname" . }}-test
+{{- end }}
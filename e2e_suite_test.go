@@ -161,6 +161,11 @@ var (
 			Repository: "meln5674/k8s-smoke-test/statefulset",
 			BuildArgs:  map[string]string{"COMPONENT": "statefulset"},
 		},
+		{
+			Registry:   "local.host",
+			Repository: "meln5674/k8s-smoke-test/daemonset",
+			BuildArgs:  map[string]string{"COMPONENT": "daemonset"},
+		},
 		{
 			Registry:   "local.host",
 			Repository: "meln5674/k8s-smoke-test/job",
@@ -0,0 +1,95 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// ConditionInstalled is the condition type indicating whether the chart was deployed and became ready
+	ConditionInstalled = "Installed"
+	// ConditionPassed is the condition type indicating whether no checks failed in the last run
+	ConditionPassed = "Passed"
+)
+
+// SmokeTestSpec is the desired state of a SmokeTest
+type SmokeTestSpec struct {
+	// Interval is how often to run the checks
+	// +kubebuilder:default="5m"
+	// +optional
+	Interval metav1.Duration `json:"interval,omitempty"`
+	// Values are the helm values to deploy the chart with, as with `helm install -f`
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +optional
+	Values *runtime.RawExtension `json:"values,omitempty"`
+	// Only is the names of the checks to run. If empty, all checks are run, except for those in Skip.
+	// +optional
+	Only []string `json:"only,omitempty"`
+	// Skip is the names of the checks to not run
+	// +optional
+	Skip []string `json:"skip,omitempty"`
+	// ContinueOnFailure indicates to continue running checks after one fails
+	// +optional
+	ContinueOnFailure bool `json:"continueOnFailure,omitempty"`
+	// Parallelism is the maximum number of checks to run at once
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Parallelism int `json:"parallelism,omitempty"`
+	// Suspend indicates to keep the chart deployed, but not run the checks
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// SmokeTestStatus is the observed state of a SmokeTest
+type SmokeTestStatus struct {
+	// ObservedGeneration is the generation of the spec the chart was last deployed with
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are the Installed and Passed conditions
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Checks has one condition per check from the last run, whose type is the name of the check.
+	// The status is True if it passed, False if it failed, and Unknown if it was skipped.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Checks []metav1.Condition `json:"checks,omitempty"`
+	// LastRunTime is when the checks were last run
+	// +optional
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+	// LastSuccessTime is when the checks last ran without any failing
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+}
+
+// SmokeTest deploys the smoke test chart, and runs its checks on a schedule
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=st
+// +kubebuilder:printcolumn:name="Installed",type=string,JSONPath=`.status.conditions[?(@.type=="Installed")].status`
+// +kubebuilder:printcolumn:name="Passed",type=string,JSONPath=`.status.conditions[?(@.type=="Passed")].status`
+// +kubebuilder:printcolumn:name="Last Run",type=date,JSONPath=`.status.lastRunTime`
+// +kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type SmokeTest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SmokeTestSpec   `json:"spec,omitempty"`
+	Status SmokeTestStatus `json:"status,omitempty"`
+}
+
+// SmokeTestList is a list of SmokeTests
+// +kubebuilder:object:root=true
+type SmokeTestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SmokeTest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SmokeTest{}, &SmokeTestList{})
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/apis/v1alpha1"
+	"github.com/meln5674/k8s-smoke-test/pkg/release"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+// Installer deploys and removes the chart for a SmokeTest
+type Installer interface {
+	// Install deploys the chart with the values of the SmokeTest, waits for it to be ready, and returns the merged values of the release
+	Install(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error)
+	// MergedValues returns the merged values of the release that was last deployed
+	MergedValues(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error)
+	// Uninstall removes the chart, including its PVCs
+	Uninstall(ctx context.Context, smokeTest *v1alpha1.SmokeTest) error
+}
+
+// HelmInstaller is an Installer which uses the helm SDK.
+// The release has the same name and namespace as the SmokeTest.
+type HelmInstaller struct {
+	// Getter is how helm connects to the cluster
+	Getter genericclioptions.RESTClientGetter
+	// K8sClient is used to delete the PVCs of the release
+	K8sClient *kubernetes.Clientset
+	// Chart is the chart to install. If nil, the chart embedded in this module is used.
+	Chart *chart.Chart
+	// Timeout is how long to wait for the release to be ready or deleted. If zero, release.DefaultTimeout is used.
+	Timeout time.Duration
+	// NoWait indicates to not wait for the release to be ready or deleted, e.g. when there are no nodes to run it
+	NoWait bool
+}
+
+func (h *HelmInstaller) options(smokeTest *v1alpha1.SmokeTest) (*release.Options, error) {
+	values := map[string]interface{}{}
+	if smokeTest.Spec.Values != nil && len(smokeTest.Spec.Values.Raw) != 0 {
+		err := json.Unmarshal(smokeTest.Spec.Values.Raw, &values)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse values")
+		}
+	}
+	return &release.Options{
+		Namespace:   smokeTest.Namespace,
+		ReleaseName: smokeTest.Name,
+		Chart:       h.Chart,
+		Values:      values,
+		Timeout:     h.Timeout,
+		NoWait:      h.NoWait,
+	}, nil
+}
+
+func (h *HelmInstaller) Install(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error) {
+	opts, err := h.options(smokeTest)
+	if err != nil {
+		return nil, err
+	}
+	actionConfig, err := release.NewActionConfig(h.Getter, smokeTest.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := release.Install(ctx, actionConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+	values, err := release.MergedValues(rel)
+	if err != nil {
+		return nil, err
+	}
+	return test.ParseMergedValues(values)
+}
+
+func (h *HelmInstaller) MergedValues(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error) {
+	actionConfig, err := release.NewActionConfig(h.Getter, smokeTest.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := release.Get(actionConfig, smokeTest.Name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := release.MergedValues(rel)
+	if err != nil {
+		return nil, err
+	}
+	return test.ParseMergedValues(values)
+}
+
+func (h *HelmInstaller) Uninstall(ctx context.Context, smokeTest *v1alpha1.SmokeTest) error {
+	opts, err := h.options(smokeTest)
+	if err != nil {
+		return err
+	}
+	actionConfig, err := release.NewActionConfig(h.Getter, smokeTest.Namespace)
+	if err != nil {
+		return err
+	}
+	return release.Uninstall(ctx, actionConfig, h.K8sClient, opts)
+}
@@ -0,0 +1,92 @@
+package controller_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/apis/v1alpha1"
+	"github.com/meln5674/k8s-smoke-test/pkg/controller"
+	"github.com/meln5674/k8s-smoke-test/pkg/release"
+)
+
+// kubeconfigFor converts the envtest REST config to a kubeconfig whose context uses a namespace,
+// as the controller's kubeconfig uses the namespace it is deployed to
+func kubeconfigFor(cfg *rest.Config, namespace string) clientcmd.ClientConfig {
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters["envtest"] = &clientcmdapi.Cluster{
+		Server:                   cfg.Host,
+		CertificateAuthorityData: cfg.CAData,
+	}
+	kubeconfig.AuthInfos["envtest"] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: cfg.CertData,
+		ClientKeyData:         cfg.KeyData,
+		Token:                 cfg.BearerToken,
+	}
+	kubeconfig.Contexts["envtest"] = &clientcmdapi.Context{Cluster: "envtest", AuthInfo: "envtest", Namespace: namespace}
+	kubeconfig.CurrentContext = "envtest"
+	return clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{})
+}
+
+var _ = Describe("HelmInstaller", func() {
+	It("should install, read and uninstall each release in the namespace of its SmokeTest", func(ctx SpecContext) {
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		Expect(err).ToNot(HaveOccurred())
+		// envtest has no nodes, so nothing will become ready, and the RWX Job would never complete
+		helmInstaller := &controller.HelmInstaller{
+			Getter:    release.NewRESTClientGetter(kubeconfigFor(restConfig, "default")),
+			K8sClient: clientset,
+			NoWait:    true,
+		}
+
+		namespaces := []string{"helm-installer-a", "helm-installer-b"}
+		smokeTests := make([]*v1alpha1.SmokeTest, 0, len(namespaces))
+		for _, ns := range namespaces {
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})).To(Succeed())
+			smokeTests = append(smokeTests, &v1alpha1.SmokeTest{
+				ObjectMeta: metav1.ObjectMeta{Name: "smoke", Namespace: ns},
+				Spec: v1alpha1.SmokeTestSpec{
+					Values: &runtime.RawExtension{Raw: []byte(`{"persistence":{"rwx":{"enabled":false}},"statefulset":{"service":{"type":"ClusterIP"}}}`)},
+				},
+			})
+		}
+
+		for _, smokeTest := range smokeTests {
+			values, err := helmInstaller.Install(ctx, smokeTest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(values.Persistence.RWX.Enabled).To(HaveValue(BeFalse()))
+		}
+
+		for _, ns := range namespaces {
+			_, err := clientset.AppsV1().Deployments(ns).Get(ctx, "smoke-k8s-smoke-test", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = clientset.AppsV1().StatefulSets(ns).Get(ctx, "smoke-k8s-smoke-test", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = clientset.CoreV1().Services(ns).Get(ctx, "smoke-k8s-smoke-test-deployment", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err = clientset.AppsV1().Deployments("default").Get(ctx, "smoke-k8s-smoke-test", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "Deployment was created in the kubeconfig namespace: %v", err)
+
+		values, err := helmInstaller.MergedValues(ctx, smokeTests[1])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(values.Persistence.RWX.Enabled).To(HaveValue(BeFalse()))
+
+		Expect(helmInstaller.Uninstall(ctx, smokeTests[0])).To(Succeed())
+		_, err = clientset.AppsV1().Deployments(namespaces[0]).Get(ctx, "smoke-k8s-smoke-test", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue(), "Deployment was not uninstalled: %v", err)
+		_, err = clientset.AppsV1().Deployments(namespaces[1]).Get(ctx, "smoke-k8s-smoke-test", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred(), "Uninstalling one release removed another with the same name")
+
+		Expect(helmInstaller.Uninstall(ctx, smokeTests[1])).To(Succeed())
+	})
+
+})
@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/apis/v1alpha1"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+// Finalizer is added to SmokeTests so that their chart is uninstalled when they are deleted
+const Finalizer = "k8s-smoke-test.meln5674.github.io/uninstall"
+
+// DefaultInterval is how often checks are run if a SmokeTest does not specify an interval
+const DefaultInterval = 5 * time.Minute
+
+// DefaultMaxConcurrentReconciles is how many SmokeTests are deployed, tested, or uninstalled at once if MaxConcurrentReconciles is not set
+const DefaultMaxConcurrentReconciles = 4
+
+// SmokeTestReconciler deploys the chart for each SmokeTest, and runs its checks every interval
+type SmokeTestReconciler struct {
+	client.Client
+	// Installer deploys and removes the chart
+	Installer Installer
+	// Config is the base configuration for each run of the checks.
+	// The release, merged values, and check selection are set from each SmokeTest.
+	Config test.Config
+	// Test runs the checks. If nil, test.Test is used.
+	Test func(ctx context.Context, cfg *test.Config) (*test.Report, error)
+	// MaxConcurrentReconciles is the maximum number of SmokeTests to deploy, test, or uninstall at once.
+	// If 0, DefaultMaxConcurrentReconciles is used.
+	MaxConcurrentReconciles int
+}
+
+// +kubebuilder:rbac:groups=k8s-smoke-test.meln5674.github.io,resources=smoketests,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=k8s-smoke-test.meln5674.github.io,resources=smoketests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=k8s-smoke-test.meln5674.github.io,resources=smoketests/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets;services;serviceaccounts;persistentvolumeclaims;configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=pods;endpoints,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/portforward,verbs=get;create
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=list
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;replicasets;daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings;clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile deploys the chart when a SmokeTest is created or its spec changes, runs the checks when they are due,
+// and uninstalls the chart when the SmokeTest is deleted.
+// The checks are run synchronously, so while MaxConcurrentReconciles SmokeTests are being tested, no other SmokeTest is deployed or uninstalled.
+func (r *SmokeTestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var smokeTest v1alpha1.SmokeTest
+	err := r.Get(ctx, req.NamespacedName, &smokeTest)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if !smokeTest.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&smokeTest, Finalizer) {
+			return ctrl.Result{}, nil
+		}
+		logger.Info("Uninstalling chart")
+		err = r.Installer.Uninstall(ctx, &smokeTest)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(&smokeTest, Finalizer)
+		return ctrl.Result{}, r.Update(ctx, &smokeTest)
+	}
+
+	if !controllerutil.ContainsFinalizer(&smokeTest, Finalizer) {
+		controllerutil.AddFinalizer(&smokeTest, Finalizer)
+		err = r.Update(ctx, &smokeTest)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	interval := smokeTest.Spec.Interval.Duration
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+
+	var mergedValues *test.MergedValues
+	specChanged := smokeTest.Status.ObservedGeneration != smokeTest.Generation
+	if specChanged || !meta.IsStatusConditionTrue(smokeTest.Status.Conditions, v1alpha1.ConditionInstalled) {
+		logger.Info("Deploying chart")
+		mergedValues, err = r.Installer.Install(ctx, &smokeTest)
+		if err != nil {
+			meta.SetStatusCondition(&smokeTest.Status.Conditions, metav1.Condition{
+				Type:               v1alpha1.ConditionInstalled,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: smokeTest.Generation,
+				Reason:             "InstallFailed",
+				Message:            err.Error(),
+			})
+			statusErr := r.Status().Update(ctx, &smokeTest)
+			if statusErr != nil {
+				logger.Error(statusErr, "Failed to update status")
+			}
+			return ctrl.Result{}, err
+		}
+		meta.SetStatusCondition(&smokeTest.Status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ConditionInstalled,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: smokeTest.Generation,
+			Reason:             "Installed",
+			Message:            "Chart is deployed and ready",
+		})
+		smokeTest.Status.ObservedGeneration = smokeTest.Generation
+	}
+
+	if smokeTest.Spec.Suspend {
+		return ctrl.Result{}, r.Status().Update(ctx, &smokeTest)
+	}
+
+	now := time.Now()
+	if !specChanged && smokeTest.Status.LastRunTime != nil {
+		next := smokeTest.Status.LastRunTime.Add(interval)
+		if now.Before(next) {
+			return ctrl.Result{RequeueAfter: next.Sub(now)}, r.Status().Update(ctx, &smokeTest)
+		}
+	}
+
+	if mergedValues == nil {
+		mergedValues, err = r.Installer.MergedValues(ctx, &smokeTest)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	cfg := r.Config
+	cfg.ReleaseNamespace = smokeTest.Namespace
+	cfg.ReleaseName = smokeTest.Name
+	cfg.MergedValues = mergedValues
+	cfg.Only = smokeTest.Spec.Only
+	cfg.Skip = smokeTest.Spec.Skip
+	cfg.ContinueOnFailure = smokeTest.Spec.ContinueOnFailure
+	cfg.Parallelism = smokeTest.Spec.Parallelism
+	runTest := r.Test
+	if runTest == nil {
+		runTest = test.Test
+	}
+	logger.Info("Running checks")
+	report, err := runTest(ctx, &cfg)
+	setStatusFromReport(&smokeTest, report, err, now)
+	if err != nil {
+		logger.Info("Checks failed", "error", err.Error())
+	}
+
+	return ctrl.Result{RequeueAfter: interval}, r.Status().Update(ctx, &smokeTest)
+}
+
+// setStatusFromReport records the outcome of a run of the checks in the status of a SmokeTest
+func setStatusFromReport(smokeTest *v1alpha1.SmokeTest, report *test.Report, err error, start time.Time) {
+	status := &smokeTest.Status
+	status.LastRunTime = &metav1.Time{Time: start}
+
+	passed := metav1.Condition{
+		Type:               v1alpha1.ConditionPassed,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: smokeTest.Generation,
+		Reason:             "Passed",
+		Message:            "No checks failed",
+	}
+	if err != nil {
+		passed.Status = metav1.ConditionFalse
+		passed.Reason = "Failed"
+		passed.Message = err.Error()
+	} else {
+		status.LastSuccessTime = &metav1.Time{Time: start}
+	}
+	meta.SetStatusCondition(&status.Conditions, passed)
+
+	seen := make(map[string]bool, len(report.Results))
+	for _, result := range report.Results {
+		seen[result.Name] = true
+		condition := metav1.Condition{
+			Type:               result.Name,
+			ObservedGeneration: smokeTest.Generation,
+		}
+		switch result.Status {
+		case test.StatusPassed:
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "Passed"
+			condition.Message = "Passed in " + result.Duration.String()
+		case test.StatusFailed:
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "Failed"
+			condition.Message = result.Error.Error()
+		default:
+			condition.Status = metav1.ConditionUnknown
+			condition.Reason = "Skipped"
+			condition.Message = result.SkipReason
+		}
+		meta.SetStatusCondition(&status.Checks, condition)
+	}
+	// Remove checks that are no longer run, e.g. because Only changed
+	for ix := 0; ix < len(status.Checks); {
+		if seen[status.Checks[ix].Type] {
+			ix++
+			continue
+		}
+		status.Checks = append(status.Checks[:ix], status.Checks[ix+1:]...)
+	}
+}
+
+func (r *SmokeTestReconciler) maxConcurrentReconciles() int {
+	if r.MaxConcurrentReconciles < 1 {
+		return DefaultMaxConcurrentReconciles
+	}
+	return r.MaxConcurrentReconciles
+}
+
+// SetupWithManager registers the reconciler with a manager.
+// Only spec changes and deletions trigger a reconcile; runs of the checks are scheduled by requeueing.
+func (r *SmokeTestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.SmokeTest{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.maxConcurrentReconciles()}).
+		Complete(r)
+}
@@ -0,0 +1,154 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/apis/v1alpha1"
+	"github.com/meln5674/k8s-smoke-test/pkg/controller"
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+// fakeInstaller records which SmokeTests are installed instead of deploying the chart
+type fakeInstaller struct {
+	lock      sync.Mutex
+	installed map[types.NamespacedName]int
+}
+
+func newFakeInstaller() *fakeInstaller {
+	return &fakeInstaller{installed: make(map[types.NamespacedName]int)}
+}
+
+func (f *fakeInstaller) Install(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.installed[client.ObjectKeyFromObject(smokeTest)]++
+	return &test.MergedValues{}, nil
+}
+
+func (f *fakeInstaller) MergedValues(ctx context.Context, smokeTest *v1alpha1.SmokeTest) (*test.MergedValues, error) {
+	return &test.MergedValues{}, nil
+}
+
+func (f *fakeInstaller) Uninstall(ctx context.Context, smokeTest *v1alpha1.SmokeTest) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.installed, client.ObjectKeyFromObject(smokeTest))
+	return nil
+}
+
+func (f *fakeInstaller) Installs(key types.NamespacedName) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.installed[key]
+}
+
+// fakeTester reports the checks selected by Only as passed, except for a check named "broken", which fails
+type fakeTester struct{}
+
+func (f *fakeTester) Test(ctx context.Context, cfg *test.Config) (*test.Report, error) {
+	report := &test.Report{Start: time.Now()}
+	for _, name := range cfg.Only {
+		result := &test.Result{Name: name, Status: test.StatusPassed, Start: time.Now()}
+		if name == "broken" {
+			result.Status = test.StatusFailed
+			result.Error = errors.New("broken")
+		}
+		report.Results = append(report.Results, result)
+	}
+	for _, name := range cfg.Skip {
+		report.Results = append(report.Results, &test.Result{Name: name, Status: test.StatusSkipped, SkipReason: "In the list of checks to skip"})
+	}
+	return report, report.Err()
+}
+
+func newSmokeTest(name string, only ...string) *v1alpha1.SmokeTest {
+	return &v1alpha1.SmokeTest{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1alpha1.SmokeTestSpec{
+			Interval: metav1.Duration{Duration: time.Hour},
+			Values:   &runtime.RawExtension{Raw: []byte(`{"deployment":{"ingress":{"enabled":false}}}`)},
+			Only:     only,
+			Skip:     []string{"ingress"},
+		},
+	}
+}
+
+func getSmokeTest(ctx context.Context, key types.NamespacedName) func() (*v1alpha1.SmokeTest, error) {
+	return func() (*v1alpha1.SmokeTest, error) {
+		var smokeTest v1alpha1.SmokeTest
+		err := k8sClient.Get(ctx, key, &smokeTest)
+		return &smokeTest, err
+	}
+}
+
+var _ = Describe("SmokeTest controller", func() {
+	It("should install the chart, record the checks in the status, and uninstall it when deleted", func(ctx context.Context) {
+		smokeTest := newSmokeTest("passing", "port-forward", "logs")
+		key := client.ObjectKeyFromObject(smokeTest)
+		Expect(k8sClient.Create(ctx, smokeTest)).To(Succeed())
+
+		Eventually(getSmokeTest(ctx, key)).Should(Satisfy(func(smokeTest *v1alpha1.SmokeTest) bool {
+			return meta.IsStatusConditionTrue(smokeTest.Status.Conditions, v1alpha1.ConditionPassed)
+		}))
+		smokeTest, err := getSmokeTest(ctx, key)()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(smokeTest.Finalizers).To(ContainElement(controller.Finalizer))
+		Expect(meta.IsStatusConditionTrue(smokeTest.Status.Conditions, v1alpha1.ConditionInstalled)).To(BeTrue())
+		Expect(smokeTest.Status.ObservedGeneration).To(Equal(smokeTest.Generation))
+		Expect(smokeTest.Status.LastRunTime).ToNot(BeNil())
+		Expect(smokeTest.Status.LastSuccessTime).ToNot(BeNil())
+		Expect(meta.IsStatusConditionTrue(smokeTest.Status.Checks, "port-forward")).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(smokeTest.Status.Checks, "logs")).To(BeTrue())
+		Expect(meta.FindStatusCondition(smokeTest.Status.Checks, "ingress").Status).To(Equal(metav1.ConditionUnknown))
+		Expect(installer.Installs(key)).To(Equal(1))
+
+		Expect(k8sClient.Delete(ctx, smokeTest)).To(Succeed())
+		Eventually(func() error {
+			_, err := getSmokeTest(ctx, key)()
+			return err
+		}).Should(Satisfy(apierrors.IsNotFound))
+		Expect(installer.Installs(key)).To(Equal(0))
+	}, SpecTimeout(time.Minute))
+
+	It("should report failed checks, and redeploy and rerun when the spec changes", func(ctx context.Context) {
+		smokeTest := newSmokeTest("failing", "port-forward", "broken")
+		key := client.ObjectKeyFromObject(smokeTest)
+		Expect(k8sClient.Create(ctx, smokeTest)).To(Succeed())
+
+		Eventually(getSmokeTest(ctx, key)).Should(Satisfy(func(smokeTest *v1alpha1.SmokeTest) bool {
+			passed := meta.FindStatusCondition(smokeTest.Status.Conditions, v1alpha1.ConditionPassed)
+			return passed != nil && passed.Status == metav1.ConditionFalse
+		}))
+		smokeTest, err := getSmokeTest(ctx, key)()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(smokeTest.Status.LastSuccessTime).To(BeNil())
+		Expect(meta.IsStatusConditionFalse(smokeTest.Status.Checks, "broken")).To(BeTrue())
+		Expect(meta.FindStatusCondition(smokeTest.Status.Checks, "broken").Message).To(Equal("broken"))
+
+		smokeTest.Spec.Only = []string{"port-forward"}
+		Expect(k8sClient.Update(ctx, smokeTest)).To(Succeed())
+
+		Eventually(getSmokeTest(ctx, key)).Should(Satisfy(func(smokeTest *v1alpha1.SmokeTest) bool {
+			return meta.IsStatusConditionTrue(smokeTest.Status.Conditions, v1alpha1.ConditionPassed)
+		}))
+		smokeTest, err = getSmokeTest(ctx, key)()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(meta.FindStatusCondition(smokeTest.Status.Checks, "broken")).To(BeNil())
+		Expect(installer.Installs(key)).To(Equal(2))
+
+		Expect(k8sClient.Delete(ctx, smokeTest)).To(Succeed())
+	}, SpecTimeout(time.Minute))
+})
@@ -0,0 +1,175 @@
+// Package dns implements the /dns endpoint of the deployment and statefulset servers,
+// which resolves names from inside the pod so that cluster DNS can be tested with the pod's resolver configuration.
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TypeA resolves IPv4 addresses
+	TypeA = "A"
+	// TypeAAAA resolves IPv6 addresses
+	TypeAAAA = "AAAA"
+	// TypeSRV resolves service records. The name must be the full record name, e.g. _http._tcp.my-service.
+	TypeSRV = "SRV"
+)
+
+// ResolvConfPath is where the resolver configuration of the pod is read from
+const ResolvConfPath = "/etc/resolv.conf"
+
+// SRV is a single SRV record
+type SRV struct {
+	Target   string `json:"target"`
+	Port     uint16 `json:"port"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+}
+
+// ResolvConf is the subset of /etc/resolv.conf which determines how names are expanded before they are resolved
+type ResolvConf struct {
+	Nameservers []string `json:"nameservers,omitempty"`
+	Search      []string `json:"search,omitempty"`
+	// Ndots is the number of dots a name must have to be tried as-is before the search domains
+	Ndots int `json:"ndots"`
+}
+
+// Response is the outcome of a lookup
+type Response struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Addresses are the answers to an A or AAAA lookup
+	Addresses []string `json:"addresses,omitempty"`
+	// CNAME is the canonical name of an A or AAAA lookup, e.g. the target of an ExternalName Service
+	CNAME string `json:"cname,omitempty"`
+	// SRV are the answers to an SRV lookup
+	SRV []SRV `json:"srv,omitempty"`
+	// DurationSeconds is how long the lookup took, including any attempts with search domains
+	DurationSeconds float64 `json:"durationSeconds"`
+	// SearchFirst is true if the name has fewer dots than ndots and no trailing dot,
+	// so the search domains were tried before the name itself
+	SearchFirst bool `json:"searchFirst"`
+	// ResolvConf is the resolver configuration the lookup was made with
+	ResolvConf ResolvConf `json:"resolvConf"`
+	// Error is why the lookup failed, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// ReadResolvConf parses the nameservers, search domains and ndots option from a resolv.conf file.
+// ndots defaults to 1, as it does for the resolver.
+func ReadResolvConf(path string) (ResolvConf, error) {
+	conf := ResolvConf{Ndots: 1}
+	f, err := os.Open(path)
+	if err != nil {
+		return conf, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.Nameservers = append(conf.Nameservers, fields[1:]...)
+		case "search", "domain":
+			conf.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				value, ok := strings.CutPrefix(option, "ndots:")
+				if !ok {
+					continue
+				}
+				ndots, err := strconv.Atoi(value)
+				if err == nil {
+					conf.Ndots = ndots
+				}
+			}
+		}
+	}
+	return conf, scanner.Err()
+}
+
+// Lookup resolves a name with the system resolver
+func Lookup(ctx context.Context, name, recordType string) *Response {
+	resp := &Response{Name: name, Type: recordType}
+	conf, err := ReadResolvConf(ResolvConfPath)
+	if err != nil {
+		log.Printf("Failed to read %s: %s", ResolvConfPath, err)
+	}
+	resp.ResolvConf = conf
+	resp.SearchFirst = !strings.HasSuffix(name, ".") && strings.Count(name, ".") < conf.Ndots
+
+	start := time.Now()
+	switch recordType {
+	case TypeA, TypeAAAA:
+		network := "ip4"
+		if recordType == TypeAAAA {
+			network = "ip6"
+		}
+		var ips []net.IP
+		ips, err = net.DefaultResolver.LookupIP(ctx, network, name)
+		for _, ip := range ips {
+			resp.Addresses = append(resp.Addresses, ip.String())
+		}
+		if err == nil {
+			resp.CNAME, _ = net.DefaultResolver.LookupCNAME(ctx, name)
+		}
+	case TypeSRV:
+		var srvs []*net.SRV
+		_, srvs, err = net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		for _, srv := range srvs {
+			resp.SRV = append(resp.SRV, SRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+		}
+	default:
+		err = fmt.Errorf("Unsupported record type %s, must be one of %s, %s, or %s", recordType, TypeA, TypeAAAA, TypeSRV)
+	}
+	resp.DurationSeconds = time.Since(start).Seconds()
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// Handler serves GET /dns?name=...&type=A|AAAA|SRV, responding with a JSON Response.
+// The type defaults to A. If the lookup fails, the status is 502, and the response still describes the failure.
+func Handler(w http.ResponseWriter, req *http.Request) {
+	log.Printf("%s %s", req.Method, req.URL.String())
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	recordType := strings.ToUpper(req.URL.Query().Get("type"))
+	if recordType == "" {
+		recordType = TypeA
+	}
+	if recordType != TypeA && recordType != TypeAAAA && recordType != TypeSRV {
+		http.Error(w, fmt.Sprintf("Unsupported record type %s", recordType), http.StatusBadRequest)
+		return
+	}
+	resp := Lookup(req.Context(), name, recordType)
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Error != "" {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Print(err)
+	}
+}
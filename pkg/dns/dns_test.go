@@ -0,0 +1,64 @@
+package dns_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/dns"
+)
+
+var _ = Describe("ReadResolvConf", func() {
+	DescribeTable("parsing resolv.conf",
+		func(contents string, expected dns.ResolvConf) {
+			path := filepath.Join(GinkgoT().TempDir(), "resolv.conf")
+			Expect(os.WriteFile(path, []byte(contents), 0o644)).To(Succeed())
+			Expect(dns.ReadResolvConf(path)).To(Equal(expected))
+		},
+		Entry("empty file", "", dns.ResolvConf{Ndots: 1}),
+		Entry("ndots defaults to 1",
+			"nameserver 10.96.0.10\nsearch default.svc.cluster.local\n",
+			dns.ResolvConf{Nameservers: []string{"10.96.0.10"}, Search: []string{"default.svc.cluster.local"}, Ndots: 1},
+		),
+		Entry("kubernetes pod",
+			"search default.svc.cluster.local svc.cluster.local cluster.local\nnameserver 10.96.0.10\noptions ndots:5\n",
+			dns.ResolvConf{
+				Nameservers: []string{"10.96.0.10"},
+				Search:      []string{"default.svc.cluster.local", "svc.cluster.local", "cluster.local"},
+				Ndots:       5,
+			},
+		),
+		Entry("ndots among other options",
+			"options timeout:2 ndots:2 attempts:3\n",
+			dns.ResolvConf{Ndots: 2},
+		),
+		Entry("invalid ndots is ignored",
+			"options ndots:many\n",
+			dns.ResolvConf{Ndots: 1},
+		),
+		Entry("the last ndots wins",
+			"options ndots:5\noptions ndots:0\n",
+			dns.ResolvConf{Ndots: 0},
+		),
+		Entry("domain",
+			"domain example.com\n",
+			dns.ResolvConf{Search: []string{"example.com"}, Ndots: 1},
+		),
+		Entry("the last of search and domain wins",
+			"domain example.com\nsearch a.example.com b.example.com\n",
+			dns.ResolvConf{Search: []string{"a.example.com", "b.example.com"}, Ndots: 1},
+		),
+		Entry("multiple nameservers",
+			"nameserver 10.96.0.10\nnameserver fd00::10\n# nameserver 192.0.2.1\n\nnameserver 8.8.8.8\n",
+			dns.ResolvConf{Nameservers: []string{"10.96.0.10", "fd00::10", "8.8.8.8"}, Ndots: 1},
+		),
+	)
+
+	It("should default ndots to 1 if the file cannot be read", func() {
+		conf, err := dns.ReadResolvConf(filepath.Join(GinkgoT().TempDir(), "missing"))
+		Expect(err).To(HaveOccurred())
+		Expect(conf).To(Equal(dns.ResolvConf{Ndots: 1}))
+	})
+})
@@ -0,0 +1,89 @@
+// Package echo implements the /echo endpoint of the deployment and statefulset servers,
+// which describes the pod that served a request and the request as the pod observed it
+package echo
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+)
+
+// PodInfo identifies the pod serving a request. It is populated from environment variables set with the downward API.
+type PodInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node"`
+	IP        string `json:"ip"`
+}
+
+// PodInfoFromEnv reads the pod info from the POD_NAME, POD_NAMESPACE, NODE_NAME and POD_IP environment variables
+func PodInfoFromEnv() PodInfo {
+	return PodInfo{
+		Name:      os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Node:      os.Getenv("NODE_NAME"),
+		IP:        os.Getenv("POD_IP"),
+	}
+}
+
+// TLSInfo describes the TLS connection a request was received on
+type TLSInfo struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipherSuite"`
+	ServerName         string `json:"serverName,omitempty"`
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+}
+
+// Response is the body of the /echo endpoint
+type Response struct {
+	// Pod is the pod that served the request
+	Pod PodInfo `json:"pod"`
+	// ClientIP is the source IP of the connection, as observed by the pod.
+	// This is only the IP of the original client if nothing between it and the pod replaced the source IP.
+	ClientIP   string `json:"clientIP"`
+	ClientPort string `json:"clientPort"`
+	Method     string `json:"method"`
+	Host       string `json:"host"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	// Headers are the request headers, including any added by proxies, such as X-Forwarded-For
+	Headers http.Header `json:"headers"`
+	// TLS describes the TLS connection, if the request was received over TLS by the pod itself
+	TLS *TLSInfo `json:"tls,omitempty"`
+}
+
+// Handler serves the /echo endpoint, responding to any method with a JSON Response
+func Handler(pod PodInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log.Printf("%s %s", req.Method, req.URL.String())
+		resp := Response{
+			Pod:     pod,
+			Method:  req.Method,
+			Host:    req.Host,
+			URI:     req.RequestURI,
+			Proto:   req.Proto,
+			Headers: req.Header,
+		}
+		var err error
+		resp.ClientIP, resp.ClientPort, err = net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			resp.ClientIP = req.RemoteAddr
+		}
+		if req.TLS != nil {
+			resp.TLS = &TLSInfo{
+				Version:            tls.VersionName(req.TLS.Version),
+				CipherSuite:        tls.CipherSuiteName(req.TLS.CipherSuite),
+				ServerName:         req.TLS.ServerName,
+				NegotiatedProtocol: req.TLS.NegotiatedProtocol,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(&resp)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
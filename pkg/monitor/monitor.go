@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/test"
+)
+
+const namespace = "k8s_smoke_test"
+
+// Metrics are the Prometheus metrics for the outcomes of repeated tests
+type Metrics struct {
+	checkSuccess     *prometheus.GaugeVec
+	checkDuration    *prometheus.HistogramVec
+	checkLastSuccess *prometheus.GaugeVec
+	success          prometheus.Gauge
+	runs             *prometheus.CounterVec
+	lastRun          prometheus.Gauge
+}
+
+// NewMetrics creates the metrics and registers them
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		checkSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "check_success",
+			Help:      "1 if the last execution of the check passed, 0 if it failed. Not updated when the check is skipped.",
+		}, []string{"check"}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "check_duration_seconds",
+			Help:      "How long each execution of the check took, including retries, whether it passed or failed",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+		}, []string{"check"}),
+		checkLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "check_last_success_timestamp_seconds",
+			Help:      "Unix time at which the check last passed",
+		}, []string{"check"}),
+		success: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "success",
+			Help:      "1 if no checks failed in the last test, 0 otherwise",
+		}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Number of tests executed, by whether any check failed",
+		}, []string{"result"}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time at which the last test finished",
+		}),
+	}
+	reg.MustRegister(m.checkSuccess, m.checkDuration, m.checkLastSuccess, m.success, m.runs, m.lastRun)
+	return m
+}
+
+// Observe updates the metrics from the report of a test
+func (m *Metrics) Observe(report *test.Report, err error) {
+	for _, result := range report.Results {
+		switch result.Status {
+		case test.StatusPassed:
+			m.checkSuccess.WithLabelValues(result.Name).Set(1)
+			m.checkLastSuccess.WithLabelValues(result.Name).Set(float64(result.Start.Add(result.Duration).Unix()))
+		case test.StatusFailed:
+			m.checkSuccess.WithLabelValues(result.Name).Set(0)
+		default:
+			continue
+		}
+		m.checkDuration.WithLabelValues(result.Name).Observe(result.Duration.Seconds())
+	}
+	if err == nil {
+		m.success.Set(1)
+		m.runs.WithLabelValues("passed").Inc()
+	} else {
+		m.success.Set(0)
+		m.runs.WithLabelValues("failed").Inc()
+	}
+	m.lastRun.SetToCurrentTime()
+}
+
+// Watch executes the test every interval until ctx is done, observing each report in metrics, then passing it to onReport, if not nil.
+// The first test is executed immediately. If a test takes longer than interval, the next one starts as soon as it finishes.
+// A failed test does not stop watching; the only error returned is ctx's.
+func Watch(ctx context.Context, cfg *test.Config, interval time.Duration, metrics *Metrics, onReport func(*test.Report, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := test.Test(ctx, cfg)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		metrics.Observe(report, err)
+		if onReport != nil {
+			onReport(report, err)
+		}
+		log.Printf("Next test in at most %s", interval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package probe implements the /probe endpoint of the daemonset server,
+// which connects to other pods and Services from inside the pod so that connectivity from each node can be tested
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+)
+
+// DefaultTimeout is how long each probe may take if the request does not set a timeout
+const DefaultTimeout = 5 * time.Second
+
+// MaxTimeout is the longest timeout a request may set
+const MaxTimeout = 30 * time.Second
+
+// MaxTargets is the most targets a single request may probe, as they are all probed at once
+const MaxTargets = 256
+
+// Result is the outcome of probing a single target
+type Result struct {
+	// Target is the host:port that was probed
+	Target string `json:"target"`
+	// Pod is the pod that served the probe, as reported by its /echo endpoint
+	Pod echo.PodInfo `json:"pod"`
+	// DurationSeconds is how long the probe took, including connecting
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Error is why the probe failed, if it failed
+	Error string `json:"error,omitempty"`
+}
+
+// Response is the body of the /probe endpoint
+type Response struct {
+	// Pod is the pod that made the probes
+	Pod echo.PodInfo `json:"pod"`
+	// Results are the outcome of each probe, in the order the targets were given
+	Results []Result `json:"results"`
+}
+
+// client does not reuse connections, so that each probe includes connecting to the target
+var client = &http.Client{
+	Transport: &http.Transport{DisableKeepAlives: true},
+}
+
+// Probe sends a GET request to the /echo endpoint of a host:port, and reports which pod served it
+func Probe(ctx context.Context, target string, timeout time.Duration) Result {
+	result := Result{Target: target}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/echo", target), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("returned non-200 error code %d", resp.StatusCode)
+		}
+		var echoResp echo.Response
+		err = json.NewDecoder(resp.Body).Decode(&echoResp)
+		if err != nil {
+			return fmt.Errorf("returned an invalid response: %s", err)
+		}
+		result.Pod = echoResp.Pod
+		return nil
+	}()
+	result.DurationSeconds = time.Since(start).Seconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// validateTarget checks that a target is an IP and port, and not an address of the node or pod itself, such as loopback,
+// or a link-local address, such as a cloud metadata service, so that the endpoint can only be used to reach other pods and Services
+func validateTarget(target string) error {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return fmt.Errorf("Invalid target %s: %s", target, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("Invalid target %s: invalid port %s", target, port)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("Invalid target %s: %s is not an IP", target, host)
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("Invalid target %s: %s is not a pod or Service IP", target, host)
+	}
+	return nil
+}
+
+// Handler serves GET /probe?target=host:port&target=...&timeout=5s, probing every target at once and responding with a JSON Response.
+// The status is 200 even if probes fail, as each result describes its failure.
+// Requests with more than MaxTargets targets, a timeout longer than MaxTimeout, or a target which is not a pod or Service IP are rejected.
+func Handler(pod echo.PodInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		log.Printf("%s %s", req.Method, req.URL.String())
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		targets := req.URL.Query()["target"]
+		if len(targets) == 0 {
+			http.Error(w, "target is required", http.StatusBadRequest)
+			return
+		}
+		if len(targets) > MaxTargets {
+			http.Error(w, fmt.Sprintf("At most %d targets may be probed at once", MaxTargets), http.StatusBadRequest)
+			return
+		}
+		for _, target := range targets {
+			if err := validateTarget(target); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		timeout := DefaultTimeout
+		if value := req.URL.Query().Get("timeout"); value != "" {
+			var err error
+			timeout, err = time.ParseDuration(value)
+			if err != nil || timeout <= 0 || timeout > MaxTimeout {
+				http.Error(w, fmt.Sprintf("Invalid timeout %s, must be positive and at most %s", value, MaxTimeout), http.StatusBadRequest)
+				return
+			}
+		}
+
+		resp := Response{Pod: pod, Results: make([]Result, len(targets))}
+		var wg sync.WaitGroup
+		for ix, target := range targets {
+			wg.Add(1)
+			go func(ix int, target string) {
+				defer wg.Done()
+				resp.Results[ix] = Probe(req.Context(), target, timeout)
+			}(ix, target)
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(&resp)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package probe_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+	"github.com/meln5674/k8s-smoke-test/pkg/probe"
+)
+
+var _ = Describe("Handler", func() {
+	manyTargets := make([]string, probe.MaxTargets+1)
+	for ix := range manyTargets {
+		manyTargets[ix] = fmt.Sprintf("10.0.%d.%d:8080", ix/256, ix%256)
+	}
+
+	DescribeTable("rejecting requests",
+		func(query url.Values) {
+			req := httptest.NewRequest(http.MethodGet, "/probe?"+query.Encode(), nil)
+			w := httptest.NewRecorder()
+			probe.Handler(echo.PodInfo{})(w, req)
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		},
+		Entry("no targets", url.Values{}),
+		Entry("too many targets", url.Values{"target": manyTargets}),
+		Entry("timeout too long", url.Values{"target": {"10.0.0.1:8080"}, "timeout": {"1h"}}),
+		Entry("negative timeout", url.Values{"target": {"10.0.0.1:8080"}, "timeout": {"-1s"}}),
+		Entry("hostname", url.Values{"target": {"metadata.google.internal:80"}}),
+		Entry("no port", url.Values{"target": {"10.0.0.1"}}),
+		Entry("invalid port", url.Values{"target": {"10.0.0.1:http"}}),
+		Entry("loopback", url.Values{"target": {"127.0.0.1:8080"}}),
+		Entry("IPv6 loopback", url.Values{"target": {"[::1]:8080"}}),
+		Entry("unspecified", url.Values{"target": {"0.0.0.0:8080"}}),
+		Entry("link-local metadata service", url.Values{"target": {"169.254.169.254:80"}}),
+		Entry("one invalid target among valid ones", url.Values{"target": {"10.0.0.1:8080", "127.0.0.1:8080"}}),
+	)
+
+	It("should probe pod and Service IPs", func() {
+		// The probe fails, as nothing is listening, but the target is accepted
+		req := httptest.NewRequest(http.MethodGet, "/probe?target=192.0.2.1:8080&timeout=10ms", nil)
+		w := httptest.NewRecorder()
+		probe.Handler(echo.PodInfo{Name: "daemonset-0"})(w, req)
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(ContainSubstring(`"target":"192.0.2.1:8080"`))
+	})
+})
@@ -0,0 +1,202 @@
+// Package release installs and uninstalls the k8s-smoke-test helm chart using the helm SDK
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+
+	chartfs "github.com/meln5674/k8s-smoke-test/deploy/helm"
+)
+
+// DefaultTimeout is how long to wait for the release to become ready if not specified
+const DefaultTimeout = 5 * time.Minute
+
+// Options are the options for installing or uninstalling a release
+type Options struct {
+	// Namespace is the namespace to install the release to
+	Namespace string
+	// ReleaseName is the name of the release
+	ReleaseName string
+	// Chart is the chart to install. If nil, the chart embedded in this module is used.
+	Chart *chart.Chart
+	// Values are the user-supplied values to install the chart with
+	Values map[string]interface{}
+	// Timeout is how long to wait for the release to be ready, including the post-install Job, or for it to be deleted.
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+	// CreateNamespace indicates to create the namespace if it does not exist
+	CreateNamespace bool
+	// KeepPVCs indicates to not delete the PVCs created by the release when uninstalling it
+	KeepPVCs bool
+	// NoWait indicates to return once the resources of the release are created, instead of waiting for them to be ready or deleted.
+	// Hooks, such as the post-install Job, are still waited for.
+	NoWait bool
+}
+
+func (o *Options) timeout() time.Duration {
+	if o.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
+
+// LoadEmbeddedChart loads the chart embedded in this module
+func LoadEmbeddedChart() (*chart.Chart, error) {
+	var files []*loader.BufferedFile
+	err := fs.WalkDir(chartfs.ChartFS, chartfs.ChartDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(chartfs.ChartFS, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, &loader.BufferedFile{
+			Name: strings.TrimPrefix(filePath, chartfs.ChartDir+"/"),
+			Data: data,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read embedded chart")
+	}
+	return loader.LoadFiles(files)
+}
+
+// NewActionConfig creates a helm SDK configuration for a namespace, storing releases in secrets, like the helm CLI does by default.
+// The resources of the release are created in the namespace, regardless of the namespace of the getter's kubeconfig,
+// so that one getter can be shared for releases in many namespaces.
+func NewActionConfig(getter genericclioptions.RESTClientGetter, namespace string) (*action.Configuration, error) {
+	actionConfig := new(action.Configuration)
+	err := actionConfig.Init(getter, namespace, "secret", log.Printf)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize helm")
+	}
+	kubeClient, ok := actionConfig.KubeClient.(*kube.Client)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected helm client type %T", actionConfig.KubeClient)
+	}
+	kubeClient.Namespace = namespace
+	return actionConfig, nil
+}
+
+// Install installs the release, or upgrades it if it already exists, equivalent to `helm upgrade --install --wait --wait-for-jobs`.
+// Unless NoWait is set, this returns once all resources are ready and the post-install Job has completed.
+func Install(ctx context.Context, actionConfig *action.Configuration, opts *Options) (*release.Release, error) {
+	chrt := opts.Chart
+	if chrt == nil {
+		var err error
+		chrt, err = LoadEmbeddedChart()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := action.NewHistory(actionConfig).Run(opts.ReleaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		log.Printf("Installing release %s to namespace %s...", opts.ReleaseName, opts.Namespace)
+		install := action.NewInstall(actionConfig)
+		install.Namespace = opts.Namespace
+		install.ReleaseName = opts.ReleaseName
+		install.CreateNamespace = opts.CreateNamespace
+		install.Wait = !opts.NoWait
+		install.WaitForJobs = !opts.NoWait
+		install.Timeout = opts.timeout()
+		rel, err := install.RunWithContext(ctx, chrt, opts.Values)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to install release %s", opts.ReleaseName)
+		}
+		return rel, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get history of release %s", opts.ReleaseName)
+	}
+
+	log.Printf("Upgrading release %s in namespace %s...", opts.ReleaseName, opts.Namespace)
+	upgrade := action.NewUpgrade(actionConfig)
+	upgrade.Namespace = opts.Namespace
+	upgrade.Wait = !opts.NoWait
+	upgrade.WaitForJobs = !opts.NoWait
+	upgrade.Timeout = opts.timeout()
+	rel, err := upgrade.RunWithContext(ctx, opts.ReleaseName, chrt, opts.Values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to upgrade release %s", opts.ReleaseName)
+	}
+	return rel, nil
+}
+
+// Get returns the latest revision of a release, equivalent to `helm get`
+func Get(actionConfig *action.Configuration, releaseName string) (*release.Release, error) {
+	rel, err := action.NewGet(actionConfig).Run(releaseName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get release %s", releaseName)
+	}
+	return rel, nil
+}
+
+// MergedValues returns the chart defaults of a release overridden by its user-supplied values,
+// equivalent to `helm get values --all`
+func MergedValues(rel *release.Release) (map[string]interface{}, error) {
+	values, err := chartutil.CoalesceValues(rel.Chart, rel.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to merge values of release %s", rel.Name)
+	}
+	return values, nil
+}
+
+// Uninstall removes the release, if it exists, and waits for its resources to be deleted.
+// Unless KeepPVCs is set, this also deletes the PVCs that helm does not,
+// namely the RWX PVC, which is marked to be kept, and those created from the StatefulSet's volumeClaimTemplates.
+func Uninstall(ctx context.Context, actionConfig *action.Configuration, k8sClient *kubernetes.Clientset, opts *Options) error {
+	log.Printf("Uninstalling release %s from namespace %s...", opts.ReleaseName, opts.Namespace)
+	uninstall := action.NewUninstall(actionConfig)
+	uninstall.IgnoreNotFound = true
+	uninstall.Wait = !opts.NoWait
+	uninstall.Timeout = opts.timeout()
+	_, err := uninstall.Run(opts.ReleaseName)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to uninstall release %s", opts.ReleaseName)
+	}
+
+	if opts.KeepPVCs {
+		return nil
+	}
+
+	// All of the chart's PVCs, including those from volumeClaimTemplates, have this label
+	selector := labels.FormatLabels(map[string]string{"app.kubernetes.io/instance": opts.ReleaseName})
+	pvcs, err := k8sClient.CoreV1().PersistentVolumeClaims(opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to list PVCs for release %s", opts.ReleaseName)
+	}
+	for _, pvc := range pvcs.Items {
+		log.Printf("Deleting PVC %s...", path.Join(pvc.Namespace, pvc.Name))
+		err = k8sClient.CoreV1().PersistentVolumeClaims(opts.Namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "Failed to delete PVC %s", pvc.Name)
+		}
+	}
+	return nil
+}
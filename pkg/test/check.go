@@ -0,0 +1,257 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Check is a single named test to execute against a deployed release
+type Check interface {
+	// Name is the unique name of the check, used in logs and to refer to it as a dependency of other checks
+	Name() string
+	// Dependencies are the names of the checks which must pass before this check is executed
+	Dependencies() []string
+	// Run executes the check, returning an error if it fails
+	Run(ctx context.Context, env *Env) error
+}
+
+// CheckFunc is a Check implemented by a plain function
+type CheckFunc struct {
+	// CheckName is returned by Name()
+	CheckName string
+	// DependsOn is returned by Dependencies()
+	DependsOn []string
+	// Func is called by Run()
+	Func func(ctx context.Context, env *Env) error
+}
+
+func (c *CheckFunc) Name() string {
+	return c.CheckName
+}
+
+func (c *CheckFunc) Dependencies() []string {
+	return c.DependsOn
+}
+
+func (c *CheckFunc) Run(ctx context.Context, env *Env) error {
+	return c.Func(ctx, env)
+}
+
+// NewCheck creates a Check from a name, function, and dependencies
+func NewCheck(name string, f func(ctx context.Context, env *Env) error, dependsOn ...string) Check {
+	return &CheckFunc{CheckName: name, DependsOn: dependsOn, Func: f}
+}
+
+// Registry is an ordered set of uniquely named checks
+type Registry struct {
+	lock   sync.Mutex
+	checks []Check
+	byName map[string]Check
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]Check)}
+}
+
+// Register adds a check to the registry. It is an error to register two checks with the same name.
+func (r *Registry) Register(check Check) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name := check.Name()
+	if name == "" {
+		return errors.New("Checks must have a name")
+	}
+	if _, ok := r.byName[name]; ok {
+		return fmt.Errorf("A check named %s is already registered", name)
+	}
+	r.checks = append(r.checks, check)
+	r.byName[name] = check
+	return nil
+}
+
+// MustRegister is like Register, but panics on error
+func (r *Registry) MustRegister(checks ...Check) {
+	for _, check := range checks {
+		err := r.Register(check)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Get returns the check with the given name, if it is registered
+func (r *Registry) Get(name string) (Check, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	check, ok := r.byName[name]
+	return check, ok
+}
+
+// Checks returns the registered checks, ordered such that every check comes after its dependencies.
+// Checks which do not depend on each other are returned in the order they were registered.
+func (r *Registry) Checks() ([]Check, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ordered := make([]Check, 0, len(r.checks))
+	// 0 = unvisited, 1 = visiting, 2 = visited
+	state := make(map[string]int, len(r.checks))
+	var visit func(check Check, path []string) error
+	visit = func(check Check, path []string) error {
+		name := check.Name()
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("Check %s has a circular dependency: %v", name, append(path, name))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, depName := range check.Dependencies() {
+			dep, ok := r.byName[depName]
+			if !ok {
+				return fmt.Errorf("Check %s depends on %s, which is not registered", name, depName)
+			}
+			err := visit(dep, append(path, name))
+			if err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, check)
+		return nil
+	}
+	for _, check := range r.checks {
+		err := visit(check, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// DefaultRegistry contains the built-in checks, and is used if a Config does not specify a Registry
+var DefaultRegistry = NewRegistry()
+
+// Register adds a check to the DefaultRegistry
+func Register(check Check) error {
+	return DefaultRegistry.Register(check)
+}
+
+// Env is the state shared between checks during a single test
+type Env struct {
+	// Config is the configuration for the test
+	Config *Config
+	// K8sClient is a client for the cluster the release was deployed to
+	K8sClient *kubernetes.Clientset
+	// Fullname is the base name of the release's resources
+	Fullname string
+
+	lock               sync.Mutex
+	deploymentPod      *corev1.Pod
+	deploymentPods     []corev1.Pod
+	statefulSetService *corev1.Service
+	ingressClient      *http.Client
+}
+
+// NewEnv creates the shared state for a test
+func NewEnv(cfg *Config) (*Env, error) {
+	k8sClient, err := cfg.K8sClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create Kubernetes client")
+	}
+	return &Env{
+		Config:    cfg,
+		K8sClient: k8sClient,
+		Fullname:  cfg.Fullname(),
+	}, nil
+}
+
+// DeploymentPod returns the pod of the Deployment to use for tests, picking it on the first call
+func (e *Env) DeploymentPod(ctx context.Context) (*corev1.Pod, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.deploymentPod != nil {
+		return e.deploymentPod, nil
+	}
+	pod, err := e.Config.PickDeploymentPod(ctx, e.K8sClient, e.Fullname)
+	if err != nil {
+		return nil, err
+	}
+	e.deploymentPod = pod
+	return pod, nil
+}
+
+// DeploymentPods returns all pods of the Deployment, listing them on the first call
+func (e *Env) DeploymentPods(ctx context.Context) ([]corev1.Pod, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.deploymentPods != nil {
+		return e.deploymentPods, nil
+	}
+	pods, err := e.Config.ListDeploymentPods(ctx, e.K8sClient, e.Fullname)
+	if err != nil {
+		return nil, err
+	}
+	e.deploymentPods = pods
+	return pods, nil
+}
+
+// NodePods returns one pod of the Deployment on each node, ordered by node name
+func (e *Env) NodePods(ctx context.Context) ([]corev1.Pod, error) {
+	pods, err := e.DeploymentPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return onePodPerNode(pods), nil
+}
+
+// invalidate discards the cached pods and Service, so that the next call of each method fetches them again.
+// This is done before a check is retried, as e.g. the load balancer status of the Service may have been filled in since the previous attempt.
+func (e *Env) invalidate() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.deploymentPod = nil
+	e.deploymentPods = nil
+	e.statefulSetService = nil
+	if e.ingressClient != nil {
+		// The client is kept, but its connections are not, so that the retry connects to the ingress again
+		e.ingressClient.CloseIdleConnections()
+	}
+}
+
+// IngressClient returns the client to use to contact the ingress, creating it on the first call
+func (e *Env) IngressClient() (*http.Client, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.ingressClient != nil {
+		return e.ingressClient, nil
+	}
+	client, err := e.Config.ingressClient()
+	if err != nil {
+		return nil, err
+	}
+	e.ingressClient = client
+	return client, nil
+}
+
+// StatefulSetService returns the Service of the StatefulSet, fetching it on the first call
+func (e *Env) StatefulSetService(ctx context.Context) (*corev1.Service, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.statefulSetService != nil {
+		return e.statefulSetService, nil
+	}
+	svc, err := e.Config.GetStatefulSetService(ctx, e.K8sClient, e.Fullname)
+	if err != nil {
+		return nil, err
+	}
+	e.statefulSetService = svc
+	return svc, nil
+}
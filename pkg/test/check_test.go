@@ -0,0 +1,87 @@
+package test
+
+import (
+	"context"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// noop is the body of a check that always passes
+func noop(ctx context.Context, env *Env) error {
+	return nil
+}
+
+// checkNames returns the names of checks, in order
+func checkNames(checks []Check) []string {
+	names := make([]string, 0, len(checks))
+	for _, check := range checks {
+		names = append(names, check.Name())
+	}
+	return names
+}
+
+var _ = ginkgo.Describe("Registry", func() {
+	ginkgo.DescribeTable("ordering checks",
+		func(checks []Check, expected []string) {
+			registry := NewRegistry()
+			registry.MustRegister(checks...)
+			ordered, err := registry.Checks()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checkNames(ordered)).To(Equal(expected))
+		},
+		ginkgo.Entry("independent checks in registration order",
+			[]Check{NewCheck("c", noop), NewCheck("a", noop), NewCheck("b", noop)},
+			[]string{"c", "a", "b"},
+		),
+		ginkgo.Entry("dependencies before dependents",
+			[]Check{NewCheck("a", noop, "b"), NewCheck("b", noop)},
+			[]string{"b", "a"},
+		),
+		ginkgo.Entry("transitive dependencies",
+			[]Check{NewCheck("a", noop, "b"), NewCheck("b", noop, "c"), NewCheck("c", noop), NewCheck("d", noop)},
+			[]string{"c", "b", "a", "d"},
+		),
+		ginkgo.Entry("shared dependencies only once",
+			[]Check{NewCheck("a", noop, "c"), NewCheck("b", noop, "c"), NewCheck("c", noop)},
+			[]string{"c", "a", "b"},
+		),
+	)
+
+	ginkgo.DescribeTable("rejecting invalid dependencies",
+		func(checks []Check, expectedErr string) {
+			registry := NewRegistry()
+			registry.MustRegister(checks...)
+			_, err := registry.Checks()
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		ginkgo.Entry("self dependency",
+			[]Check{NewCheck("a", noop, "a")},
+			"circular dependency: [a a]",
+		),
+		ginkgo.Entry("cycle",
+			[]Check{NewCheck("a", noop, "b"), NewCheck("b", noop, "c"), NewCheck("c", noop, "a")},
+			"circular dependency: [a b c a]",
+		),
+		ginkgo.Entry("unregistered dependency",
+			[]Check{NewCheck("a", noop, "missing")},
+			"depends on missing, which is not registered",
+		),
+	)
+
+	ginkgo.It("should reject duplicate names", func() {
+		registry := NewRegistry()
+		Expect(registry.Register(NewCheck("a", noop))).To(Succeed())
+		Expect(registry.Register(NewCheck("a", noop))).To(MatchError(ContainSubstring("already registered")))
+	})
+
+	ginkgo.It("should reject checks without a name", func() {
+		Expect(NewRegistry().Register(NewCheck("", noop))).ToNot(Succeed())
+	})
+
+	ginkgo.It("should register the built-in checks in a valid order", func() {
+		checks, err := DefaultRegistry.Checks()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(checks).ToNot(BeEmpty())
+	})
+})
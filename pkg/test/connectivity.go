@@ -0,0 +1,268 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/probe"
+)
+
+// connectivityTimeout is how long each connection in the connectivity matrix may take before it is considered failed
+const connectivityTimeout = 5 * time.Second
+
+// matrixService is the column of the connectivity matrix for connections to the DaemonSet's Service
+const matrixService = "service"
+
+// ListDaemonSetPods lists one pod of the DaemonSet with an IP on each node, ordered by node name.
+// Unlike ListDeploymentPods, pods which are not ready are included, as a pod made unready by a broken network is exactly what the connectivity matrix is for.
+func (cfg *Config) ListDaemonSetPods(ctx context.Context, k8sClient *kubernetes.Clientset, daemonSetService *corev1.Service) ([]corev1.Pod, error) {
+	daemonSetPods, err := k8sClient.CoreV1().Pods(cfg.ReleaseNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.FormatLabels(daemonSetService.Spec.Selector),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list DaemonSet Pods")
+	}
+	pods := make([]corev1.Pod, 0, len(daemonSetPods.Items))
+	for _, pod := range daemonSetPods.Items {
+		if pod.DeletionTimestamp == nil && pod.Status.PodIP != "" {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("None of the %d DaemonSet pods have an IP", len(daemonSetPods.Items))
+	}
+	return onePodPerNode(pods), nil
+}
+
+// probeTargets asks the /probe endpoint of a server to connect to each of a set of host:port targets,
+// in batches of at most probe.MaxTargets
+func probeTargets(ctx context.Context, cfg *Config, baseURL string, targets []string) (*probe.Response, error) {
+	var resp probe.Response
+	for start := 0; start < len(targets); start += probe.MaxTargets {
+		end := min(start+probe.MaxTargets, len(targets))
+		batch, err := probeTargetBatch(ctx, cfg, baseURL, targets[start:end])
+		if err != nil {
+			return nil, err
+		}
+		resp.Pod = batch.Pod
+		resp.Results = append(resp.Results, batch.Results...)
+	}
+	return &resp, nil
+}
+
+// probeTargetBatch asks the /probe endpoint of a server to connect to each of a set of host:port targets in a single request
+func probeTargetBatch(ctx context.Context, cfg *Config, baseURL string, targets []string) (*probe.Response, error) {
+	query := url.Values{"target": targets, "timeout": {connectivityTimeout.String()}}
+	reqURL := baseURL + "/probe?" + query.Encode()
+	RecordURL(ctx, reqURL)
+	resp, err := httpGet(ctx, cfg.HTTP, reqURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to %s", reqURL)
+	}
+	defer resp.Body.Close()
+	RecordResponse(ctx, reqURL, resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read body from %s", reqURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned non-200 error code %d: %s", reqURL, resp.StatusCode, string(body))
+	}
+	var probeResp probe.Response
+	err = json.Unmarshal(body, &probeResp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse response from %s", reqURL)
+	}
+	if len(probeResp.Results) != len(targets) {
+		return nil, fmt.Errorf("%s returned %d results for %d targets", reqURL, len(probeResp.Results), len(targets))
+	}
+	return &probeResp, nil
+}
+
+// matrixCell is the outcome of one connection in the connectivity matrix
+type matrixCell struct {
+	latency time.Duration
+	// failure is why the connection failed, or an empty string if it succeeded
+	failure string
+}
+
+func (c matrixCell) String() string {
+	if c.failure != "" {
+		return "FAIL"
+	}
+	return c.latency.Round(time.Microsecond).String()
+}
+
+// formatMatrix renders the connectivity matrix as a table, with a row for each source node and a column for each target
+func formatMatrix(nodes []string, matrix map[string]map[string]matrixCell) string {
+	columns := append(append([]string{}, nodes...), matrixService)
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "FROM \\ TO\t%s\n", strings.Join(columns, "\t"))
+	for _, from := range nodes {
+		cells := make([]string, 0, len(columns))
+		for _, to := range columns {
+			cell, ok := matrix[from][to]
+			if !ok {
+				cells = append(cells, "-")
+				continue
+			}
+			cells = append(cells, cell.String())
+		}
+		fmt.Fprintf(w, "%s\t%s\n", from, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// isolatedNodes returns the nodes for which every connection to and from the other nodes failed, which most likely have a broken network themselves.
+// If that is true of every node, the problem is not specific to any of them, and none are returned.
+func isolatedNodes(nodes []string, matrix map[string]map[string]matrixCell) []string {
+	if len(nodes) < 3 {
+		// With two nodes, it is impossible to tell which side is broken
+		return nil
+	}
+	var isolated []string
+	for _, node := range nodes {
+		allFailed := true
+		for _, other := range nodes {
+			if other == node {
+				continue
+			}
+			if matrix[node][other].failure == "" || matrix[other][node].failure == "" {
+				allFailed = false
+				break
+			}
+		}
+		if allFailed {
+			isolated = append(isolated, node)
+		}
+	}
+	if len(isolated) == len(nodes) {
+		return nil
+	}
+	return isolated
+}
+
+// TestConnectivityMatrix has the DaemonSet pod on each node connect to the pod IP of every DaemonSet pod, including itself, and to the ClusterIP of the DaemonSet Service,
+// using their /probe endpoints through a port-forward. Connections to pods must be served by that pod, and connections to the Service by any DaemonSet pod.
+// The latency or failure of each connection is recorded as a detail of the result, keyed by source and target node, and the matrix is logged as a table.
+// Every connection is made even if some fail, and the error lists every failed connection, and any node which could neither connect to nor be reached from any other.
+func TestConnectivityMatrix(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string) error {
+	serviceName := fullname + "-daemonset"
+	service, err := k8sClient.CoreV1().Services(cfg.ReleaseNamespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get Service %s", serviceName)
+	}
+	servicePortNumber, err := servicePort(service, "http")
+	if err != nil {
+		return err
+	}
+	pods, err := cfg.ListDaemonSetPods(ctx, k8sClient, service)
+	if err != nil {
+		return err
+	}
+	RecordDetail(ctx, "nodes", fmt.Sprintf("%d", len(pods)))
+
+	nodes := make([]string, 0, len(pods))
+	podNodes := make(map[string]string, len(pods))
+	targets := make([]string, 0, len(pods)+1)
+	columns := make([]string, 0, len(pods)+1)
+	for _, pod := range pods {
+		nodes = append(nodes, pod.Spec.NodeName)
+		podNodes[pod.Name] = pod.Spec.NodeName
+		targets = append(targets, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(serverPort)))
+		columns = append(columns, pod.Spec.NodeName)
+	}
+	targets = append(targets, net.JoinHostPort(service.Spec.ClusterIP, strconv.Itoa(int(servicePortNumber))))
+	columns = append(columns, matrixService)
+
+	matrix := make(map[string]map[string]matrixCell, len(pods))
+	var failures []string
+	for ix := range pods {
+		from := &pods[ix]
+		row := make(map[string]matrixCell, len(columns))
+		matrix[from.Spec.NodeName] = row
+		err := withPortForward(ctx, cfg, from.Name, serverPort, func(baseURL string) error {
+			resp, err := probeTargets(ctx, cfg, baseURL, targets)
+			if err != nil {
+				return err
+			}
+			for jx, result := range resp.Results {
+				to := columns[jx]
+				cell := matrixCell{
+					latency: time.Duration(result.DurationSeconds * float64(time.Second)),
+					failure: result.Error,
+				}
+				servedBy, ok := podNodes[result.Pod.Name]
+				switch {
+				case cell.failure != "":
+				case !ok:
+					cell.failure = fmt.Sprintf("served by %s, which is not a DaemonSet pod", result.Pod.Name)
+				case to != matrixService && servedBy != to:
+					cell.failure = fmt.Sprintf("served by %s on node %s instead of the pod on node %s", result.Pod.Name, servedBy, to)
+				}
+				row[to] = cell
+				key := fmt.Sprintf("%s -> %s", from.Spec.NodeName, to)
+				if cell.failure != "" {
+					RecordDetail(ctx, key, fmt.Sprintf("failed (%s): %s", cell.latency.Round(time.Microsecond), cell.failure))
+					failures = append(failures, fmt.Sprintf("%s (%s): %s", key, result.Target, cell.failure))
+					continue
+				}
+				if to == matrixService {
+					RecordDetail(ctx, key, fmt.Sprintf("%s, served by node %s", cell.latency.Round(time.Microsecond), servedBy))
+					continue
+				}
+				RecordDetail(ctx, key, cell.latency.Round(time.Microsecond).String())
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// Without the row, the whole of it is unknown, so mark it failed rather than aborting the other rows
+			for _, to := range columns {
+				row[to] = matrixCell{failure: err.Error()}
+			}
+			RecordDetail(ctx, fmt.Sprintf("%s -> *", from.Spec.NodeName), fmt.Sprintf("failed: %s", err))
+			failures = append(failures, fmt.Sprintf("from pod %s on node %s: %s", from.Name, from.Spec.NodeName, err))
+		}
+	}
+
+	log.Printf("Connectivity matrix:\n%s", formatMatrix(nodes, matrix))
+	if len(failures) == 0 {
+		return nil
+	}
+	failed := 0
+	for _, row := range matrix {
+		for _, cell := range row {
+			if cell.failure != "" {
+				failed++
+			}
+		}
+	}
+	var hints []string
+	for _, node := range isolatedNodes(nodes, matrix) {
+		hints = append(hints, fmt.Sprintf("node %s could neither connect to nor be reached from any other node", node))
+	}
+	return fmt.Errorf("%d of %d connections failed: %s", failed, len(pods)*len(columns), strings.Join(append(hints, failures...), "; "))
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+	"github.com/meln5674/k8s-smoke-test/pkg/probe"
+)
+
+// connectivityMatrix builds a complete matrix between nodes, where the connections in failed, as "from -> to", failed, and the rest succeeded
+func connectivityMatrix(nodes []string, failed ...string) map[string]map[string]matrixCell {
+	matrix := make(map[string]map[string]matrixCell, len(nodes))
+	for _, from := range nodes {
+		matrix[from] = make(map[string]matrixCell, len(nodes)+1)
+		for _, to := range append(append([]string{}, nodes...), matrixService) {
+			matrix[from][to] = matrixCell{latency: time.Millisecond}
+		}
+	}
+	for _, connection := range failed {
+		from, to, _ := strings.Cut(connection, " -> ")
+		matrix[from][to] = matrixCell{failure: "connection refused"}
+	}
+	return matrix
+}
+
+var _ = ginkgo.DescribeTable("isolatedNodes",
+	func(nodes []string, failed []string, expected []string) {
+		Expect(isolatedNodes(nodes, connectivityMatrix(nodes, failed...))).To(Equal(expected))
+	},
+	ginkgo.Entry("no failures", []string{"node-1", "node-2", "node-3"}, nil, nil),
+	ginkgo.Entry("two nodes which cannot reach each other",
+		[]string{"node-1", "node-2"},
+		[]string{"node-1 -> node-2", "node-2 -> node-1"},
+		nil,
+	),
+	ginkgo.Entry("one node which can neither connect to nor be reached from the others",
+		[]string{"node-1", "node-2", "node-3"},
+		[]string{"node-3 -> node-1", "node-3 -> node-2", "node-1 -> node-3", "node-2 -> node-3"},
+		[]string{"node-3"},
+	),
+	ginkgo.Entry("one node which cannot be reached, but can connect to another",
+		[]string{"node-1", "node-2", "node-3"},
+		[]string{"node-3 -> node-2", "node-1 -> node-3", "node-2 -> node-3"},
+		nil,
+	),
+	ginkgo.Entry("a failure to the Service only",
+		[]string{"node-1", "node-2", "node-3"},
+		[]string{"node-3 -> service"},
+		nil,
+	),
+	ginkgo.Entry("every node",
+		[]string{"node-1", "node-2", "node-3"},
+		[]string{
+			"node-1 -> node-2", "node-1 -> node-3",
+			"node-2 -> node-1", "node-2 -> node-3",
+			"node-3 -> node-1", "node-3 -> node-2",
+		},
+		nil,
+	),
+)
+
+var _ = ginkgo.Describe("formatMatrix", func() {
+	ginkgo.It("should render latencies, failures and missing connections", func() {
+		nodes := []string{"node-1", "node-2"}
+		matrix := map[string]map[string]matrixCell{
+			"node-1": {
+				"node-1":      {latency: 1500 * time.Microsecond},
+				"node-2":      {latency: time.Second, failure: "i/o timeout"},
+				matrixService: {latency: 2*time.Millisecond + 300*time.Nanosecond},
+			},
+		}
+		Expect(formatMatrix(nodes, matrix)).To(Equal(
+			"FROM \\ TO  node-1  node-2  service\n" +
+				"node-1     1.5ms   FAIL    2ms\n" +
+				"node-2     -       -       -\n",
+		))
+	})
+})
+
+var _ = ginkgo.Describe("probeTargets", func() {
+	// serveProbes responds to every /probe request with a successful result for each target, and records the number of targets of each request
+	serveProbes := func() (*httptest.Server, func() []int) {
+		var mu sync.Mutex
+		var batches []int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			targets := r.URL.Query()["target"]
+			mu.Lock()
+			batches = append(batches, len(targets))
+			mu.Unlock()
+			if len(targets) > probe.MaxTargets {
+				http.Error(w, "too many targets", http.StatusBadRequest)
+				return
+			}
+			resp := probe.Response{Pod: echo.PodInfo{Name: "pod-0"}}
+			for _, target := range targets {
+				resp.Results = append(resp.Results, probe.Result{Target: target, Pod: echo.PodInfo{Name: "pod-" + target}})
+			}
+			json.NewEncoder(w).Encode(resp)
+		}))
+		ginkgo.DeferCleanup(srv.Close)
+		return srv, func() []int {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]int{}, batches...)
+		}
+	}
+
+	targetsOf := func(n int) []string {
+		targets := make([]string, 0, n)
+		for ix := 0; ix < n; ix++ {
+			targets = append(targets, fmt.Sprintf("10.0.%d.%d:8080", ix/256, ix%256))
+		}
+		return targets
+	}
+
+	ginkgo.DescribeTable("batching",
+		func(ctx ginkgo.SpecContext, n int, expectedBatches []int) {
+			srv, batches := serveProbes()
+			targets := targetsOf(n)
+			resp, err := probeTargets(ctx, &Config{HTTP: srv.Client()}, srv.URL, targets)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(batches()).To(Equal(expectedBatches))
+			Expect(resp.Pod.Name).To(Equal("pod-0"))
+			resultTargets := make([]string, 0, len(resp.Results))
+			for _, result := range resp.Results {
+				resultTargets = append(resultTargets, result.Target)
+			}
+			Expect(resultTargets).To(Equal(targets))
+		},
+		ginkgo.Entry("one target", 1, []int{1}),
+		ginkgo.Entry("exactly MaxTargets", probe.MaxTargets, []int{probe.MaxTargets}),
+		ginkgo.Entry("one more than MaxTargets", probe.MaxTargets+1, []int{probe.MaxTargets, 1}),
+		ginkgo.Entry("several batches", 2*probe.MaxTargets+3, []int{probe.MaxTargets, probe.MaxTargets, 3}),
+	)
+
+	ginkgo.It("should reject a response with the wrong number of results", func(ctx ginkgo.SpecContext) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(probe.Response{Results: []probe.Result{{Target: "10.0.0.0:8080"}}})
+		}))
+		ginkgo.DeferCleanup(srv.Close)
+		_, err := probeTargets(ctx, &Config{HTTP: srv.Client()}, srv.URL, targetsOf(2))
+		Expect(err).To(MatchError(ContainSubstring("returned 1 results for 2 targets")))
+	})
+
+	ginkgo.It("should fail on a non-200 response", func(ctx ginkgo.SpecContext) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "At most 256 targets may be probed at once", http.StatusBadRequest)
+		}))
+		ginkgo.DeferCleanup(srv.Close)
+		_, err := probeTargets(ctx, &Config{HTTP: srv.Client()}, srv.URL, targetsOf(1))
+		Expect(err).To(MatchError(ContainSubstring("returned non-200 error code 400")))
+	})
+})
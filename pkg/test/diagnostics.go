@@ -0,0 +1,277 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/describe"
+)
+
+// diagnosticBundle writes files to a tarball, and records anything that could not be collected
+type diagnosticBundle struct {
+	tw      *tar.Writer
+	modTime time.Time
+	// failures are the items that could not be collected, written to errors.txt
+	failures []string
+	// err is the first error writing to the tarball, after which nothing more is written
+	err error
+}
+
+func (b *diagnosticBundle) add(name string, content []byte) {
+	if b.err != nil {
+		return
+	}
+	err := b.tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: b.modTime})
+	if err == nil {
+		_, err = b.tw.Write(content)
+	}
+	if err != nil {
+		b.err = errors.Wrapf(err, "Failed to write %s to diagnostic bundle", name)
+	}
+}
+
+func (b *diagnosticBundle) failed(err error, format string, args ...interface{}) {
+	msg := fmt.Sprintf("%s: %s", fmt.Sprintf(format, args...), err)
+	log.Print(msg)
+	b.failures = append(b.failures, msg)
+}
+
+// describe adds the kubectl describe output, including events, of each named object of a kind
+func (b *diagnosticBundle) describe(cfg *Config, kind schema.GroupKind, namespace string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	describer, ok := describe.DescriberFor(kind, cfg.K8sConfig)
+	if !ok {
+		b.failed(errors.New("no describer is available"), "Failed to describe %s", kind.Kind)
+		return
+	}
+	for _, name := range names {
+		out, err := describer.Describe(namespace, name, describe.DescriberSettings{ShowEvents: true, ChunkSize: 500})
+		if err != nil {
+			b.failed(err, "Failed to describe %s %s", kind.Kind, name)
+			continue
+		}
+		b.add(fmt.Sprintf("describe/%s/%s.txt", strings.ToLower(kind.Kind), name), []byte(out))
+	}
+}
+
+// logs adds the logs of each container of a pod, including the previous instance of any container that has restarted.
+// Logs are limited to LogsMaxBytes, if set.
+func (b *diagnosticBundle) logs(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, pod *corev1.Pod) {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		previous := []bool{false}
+		if status.RestartCount > 0 {
+			previous = append(previous, true)
+		}
+		for _, prev := range previous {
+			opts := &corev1.PodLogOptions{Container: status.Name, Previous: prev, Timestamps: true}
+			if cfg.LogsMaxBytes > 0 {
+				limit := cfg.LogsMaxBytes
+				opts.LimitBytes = &limit
+			}
+			name := fmt.Sprintf("logs/%s/%s.log", pod.Name, status.Name)
+			if prev {
+				name = fmt.Sprintf("logs/%s/%s.previous.log", pod.Name, status.Name)
+			}
+			out, err := k8sClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts).DoRaw(ctx)
+			if err != nil {
+				b.failed(err, "Failed to get logs for %s", name)
+				continue
+			}
+			b.add(name, out)
+		}
+	}
+}
+
+// events adds a table of every event in the namespace, oldest first
+func (b *diagnosticBundle) events(ctx context.Context, k8sClient *kubernetes.Clientset, namespace string) {
+	events, err := k8sClient.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		b.failed(err, "Failed to list events")
+		return
+	}
+	lastSeen := func(event *corev1.Event) time.Time {
+		switch {
+		case !event.LastTimestamp.IsZero():
+			return event.LastTimestamp.Time
+		case !event.EventTime.IsZero():
+			return event.EventTime.Time
+		default:
+			return event.CreationTimestamp.Time
+		}
+	}
+	items := events.Items
+	sort.SliceStable(items, func(i, j int) bool { return lastSeen(&items[i]).Before(lastSeen(&items[j])) })
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for ix := range items {
+		event := &items[ix]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%d\t%s\n",
+			lastSeen(event).Format(time.RFC3339), event.Type, event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name, event.Count,
+			strings.TrimSpace(event.Message),
+		)
+	}
+	w.Flush()
+	b.add("events.txt", buf.Bytes())
+}
+
+// responses adds the status and headers of every HTTP response received by each check, such as those from the ingress controller
+func (b *diagnosticBundle) responses(report *Report) {
+	for _, result := range report.Results {
+		if len(result.Responses) == 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		for _, response := range result.Responses {
+			fmt.Fprintf(&buf, "%s\n%s\n", response.URL, response.Status)
+			response.Header.Write(&buf)
+			buf.WriteString("\n")
+		}
+		b.add(fmt.Sprintf("responses/%s.txt", result.Name), buf.Bytes())
+	}
+}
+
+func (b *diagnosticBundle) collect(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, report *Report) {
+	ns := cfg.ReleaseNamespace
+	fullname := cfg.Fullname()
+	selector := labels.FormatLabels(map[string]string{"app.kubernetes.io/instance": cfg.ReleaseName})
+	listOpts := metav1.ListOptions{LabelSelector: selector}
+
+	var buf bytes.Buffer
+	err := report.WriteJSON(&buf)
+	if err != nil {
+		b.failed(err, "Failed to serialize report")
+	} else {
+		b.add("report.json", buf.Bytes())
+	}
+	b.responses(report)
+
+	claimNames := map[string]bool{}
+	pods, err := k8sClient.CoreV1().Pods(ns).List(ctx, listOpts)
+	if err != nil {
+		b.failed(err, "Failed to list pods")
+	} else {
+		var names []string
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+			for _, volume := range pod.Spec.Volumes {
+				if volume.PersistentVolumeClaim != nil {
+					claimNames[volume.PersistentVolumeClaim.ClaimName] = true
+				}
+			}
+		}
+		b.describe(cfg, schema.GroupKind{Kind: "Pod"}, ns, names)
+		for ix := range pods.Items {
+			b.logs(ctx, cfg, k8sClient, &pods.Items[ix])
+		}
+	}
+
+	services, err := k8sClient.CoreV1().Services(ns).List(ctx, listOpts)
+	if err != nil {
+		b.failed(err, "Failed to list services")
+	} else {
+		var names, sliceNames []string
+		for _, service := range services.Items {
+			names = append(names, service.Name)
+			slices, err := k8sClient.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+				LabelSelector: labels.FormatLabels(map[string]string{discoveryv1.LabelServiceName: service.Name}),
+			})
+			if err != nil {
+				b.failed(err, "Failed to list endpoint slices for service %s", service.Name)
+				continue
+			}
+			for _, slice := range slices.Items {
+				sliceNames = append(sliceNames, slice.Name)
+			}
+		}
+		b.describe(cfg, schema.GroupKind{Kind: "Service"}, ns, names)
+		b.describe(cfg, schema.GroupKind{Kind: "Endpoints"}, ns, names)
+		b.describe(cfg, schema.GroupKind{Group: discoveryv1.GroupName, Kind: "EndpointSlice"}, ns, sliceNames)
+	}
+
+	ingresses, err := k8sClient.NetworkingV1().Ingresses(ns).List(ctx, listOpts)
+	if err != nil {
+		b.failed(err, "Failed to list ingresses")
+	} else {
+		var names []string
+		for _, ingress := range ingresses.Items {
+			names = append(names, ingress.Name)
+		}
+		b.describe(cfg, schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}, ns, names)
+	}
+
+	// StatefulSet PVCs are not guaranteed to have the release labels, so also include those named after the StatefulSet,
+	// and those mounted by the release's pods
+	pvcs, err := k8sClient.CoreV1().PersistentVolumeClaims(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		b.failed(err, "Failed to list persistent volume claims")
+	} else {
+		var pvcNames, pvNames []string
+		for _, pvc := range pvcs.Items {
+			if pvc.Labels["app.kubernetes.io/instance"] != cfg.ReleaseName && !claimNames[pvc.Name] && !strings.HasPrefix(pvc.Name, fmt.Sprintf("rwo-%s-", fullname)) {
+				continue
+			}
+			pvcNames = append(pvcNames, pvc.Name)
+			if pvc.Spec.VolumeName != "" {
+				pvNames = append(pvNames, pvc.Spec.VolumeName)
+			}
+		}
+		b.describe(cfg, schema.GroupKind{Kind: "PersistentVolumeClaim"}, ns, pvcNames)
+		b.describe(cfg, schema.GroupKind{Kind: "PersistentVolume"}, "", pvNames)
+	}
+
+	b.events(ctx, k8sClient, ns)
+}
+
+// CollectDiagnostics writes a gzipped tarball to path containing everything needed to diagnose a failed test:
+// the report, the status and headers of every HTTP response received by the checks,
+// kubectl describe output for the Pods, Services, Endpoints, EndpointSlices, Ingress, PVCs and PVs of the release,
+// every event in the namespace, and the current and previous logs of every container.
+// Anything that cannot be collected is listed in errors.txt in the tarball instead of failing the whole bundle.
+func CollectDiagnostics(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, report *Report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create diagnostic bundle")
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	b := &diagnosticBundle{tw: tar.NewWriter(gz), modTime: time.Now()}
+
+	b.collect(ctx, cfg, k8sClient, report)
+	if len(b.failures) != 0 {
+		b.add("errors.txt", []byte(strings.Join(b.failures, "\n")+"\n"))
+	}
+	if b.err != nil {
+		return b.err
+	}
+	err = b.tw.Close()
+	if err != nil {
+		return errors.Wrap(err, "Failed to write diagnostic bundle")
+	}
+	err = gz.Close()
+	if err != nil {
+		return errors.Wrap(err, "Failed to write diagnostic bundle")
+	}
+	return f.Close()
+}
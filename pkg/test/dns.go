@@ -0,0 +1,280 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/dns"
+)
+
+// defaultClusterDomain is used if dns.clusterDomain is not set in the values.yaml
+const defaultClusterDomain = "cluster.local"
+
+// dnsLookup is a single name to resolve in the dns check, and what the answer must be
+type dnsLookup struct {
+	name       string
+	recordType string
+	// check returns why the answer is wrong, or an empty string if it is right
+	check func(resp *dns.Response) string
+}
+
+// ipsOfFamily returns the IPv4 or IPv6 addresses of a list, sorted
+func ipsOfFamily(ips []string, ipv6 bool) []string {
+	var matching []string
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed != nil && (parsed.To4() == nil) == ipv6 {
+			matching = append(matching, parsed.String())
+		}
+	}
+	sort.Strings(matching)
+	return matching
+}
+
+func expectAddresses(want []string) func(resp *dns.Response) string {
+	return func(resp *dns.Response) string {
+		got := append([]string{}, resp.Addresses...)
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			return fmt.Sprintf("resolved to %v instead of %v", got, want)
+		}
+		return ""
+	}
+}
+
+func expectSRVPort(port int32) func(resp *dns.Response) string {
+	return func(resp *dns.Response) string {
+		for _, srv := range resp.SRV {
+			if int32(srv.Port) == port {
+				return ""
+			}
+		}
+		return fmt.Sprintf("has no record for port %d: %v", port, resp.SRV)
+	}
+}
+
+func expectCNAME(target string) func(resp *dns.Response) string {
+	return func(resp *dns.Response) string {
+		if strings.TrimSuffix(resp.CNAME, ".") != strings.TrimSuffix(target, ".") {
+			return fmt.Sprintf("has canonical name %s instead of %s", resp.CNAME, target)
+		}
+		if len(resp.Addresses) == 0 {
+			return "resolved to no addresses"
+		}
+		return ""
+	}
+}
+
+// servicePort returns the port of a Service with a name
+func servicePort(service *corev1.Service, name string) (int32, error) {
+	for _, port := range service.Spec.Ports {
+		if port.Name == name {
+			return port.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("Service %s has no port named %s", service.Name, name)
+}
+
+// dnsLookups returns the names to resolve in the dns check.
+// These are the Deployment Service by short name, partially-qualified names, and its FQDN with and without a trailing dot,
+// the headless StatefulSet Service and the per-pod name of the StatefulSet pod under its governing Service, SRV records for the http port of both Services,
+// and the ExternalName Service, if enabled. AAAA lookups are added for each address lookup if the Services have IPv6 addresses.
+func dnsLookups(ctx context.Context, cfg *Config, k8sClient kubernetes.Interface, fullname string) ([]dnsLookup, error) {
+	ns := cfg.ReleaseNamespace
+	values := cfg.MergedValues.DNS
+	domain := values.ClusterDomain
+	if domain == "" {
+		domain = defaultClusterDomain
+	}
+	fqdn := func(name string) string {
+		return fmt.Sprintf("%s.%s.svc.%s.", name, ns, domain)
+	}
+
+	serviceName := fullname + "-deployment"
+	service, err := k8sClient.CoreV1().Services(ns).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get Service %s", serviceName)
+	}
+	servicePortNumber, err := servicePort(service, "http")
+	if err != nil {
+		return nil, err
+	}
+	clusterIPs := service.Spec.ClusterIPs
+	if len(clusterIPs) == 0 {
+		clusterIPs = []string{service.Spec.ClusterIP}
+	}
+
+	headlessName := fullname + "-statefulset-headless"
+	headless, err := k8sClient.CoreV1().Services(ns).Get(ctx, headlessName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get Service %s", headlessName)
+	}
+	headlessPortNumber, err := servicePort(headless, "http")
+	if err != nil {
+		return nil, err
+	}
+
+	podName := fullname + "-0"
+	pod, err := k8sClient.CoreV1().Pods(ns).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get StatefulSet pod %s", podName)
+	}
+	var podIPs []string
+	for _, podIP := range pod.Status.PodIPs {
+		podIPs = append(podIPs, podIP.IP)
+	}
+	// The per-pod name is under the Service governing the StatefulSet, which is the pod's subdomain
+	if pod.Spec.Subdomain == "" {
+		return nil, fmt.Errorf("StatefulSet pod %s has no subdomain", podName)
+	}
+	perPodName := pod.Spec.Hostname + "." + pod.Spec.Subdomain
+
+	var lookups []dnsLookup
+	addressType := ""
+	for _, ipv6 := range []bool{false, true} {
+		recordType := dns.TypeA
+		if ipv6 {
+			recordType = dns.TypeAAAA
+		}
+		want := ipsOfFamily(clusterIPs, ipv6)
+		if len(want) == 0 {
+			continue
+		}
+		if addressType == "" {
+			addressType = recordType
+		}
+		for _, name := range []string{
+			serviceName,
+			serviceName + "." + ns,
+			serviceName + "." + ns + ".svc",
+			strings.TrimSuffix(fqdn(serviceName), "."),
+			fqdn(serviceName),
+		} {
+			lookups = append(lookups, dnsLookup{name: name, recordType: recordType, check: expectAddresses(want)})
+		}
+		podWant := ipsOfFamily(podIPs, ipv6)
+		for _, name := range []string{fqdn(headlessName), perPodName, fqdn(perPodName)} {
+			lookups = append(lookups, dnsLookup{name: name, recordType: recordType, check: expectAddresses(podWant)})
+		}
+	}
+	if addressType == "" {
+		return nil, fmt.Errorf("Service %s has no cluster IPs", serviceName)
+	}
+
+	lookups = append(lookups,
+		dnsLookup{name: "_http._tcp." + fqdn(serviceName), recordType: dns.TypeSRV, check: expectSRVPort(servicePortNumber)},
+		dnsLookup{name: "_http._tcp." + fqdn(headlessName), recordType: dns.TypeSRV, check: expectSRVPort(headlessPortNumber)},
+	)
+
+	if isEnabled(values.ExternalName.Enabled) {
+		target := values.ExternalName.Target
+		if target == "" {
+			target = "kubernetes.default.svc." + domain
+		}
+		lookups = append(lookups, dnsLookup{name: fqdn(fullname + "-external"), recordType: addressType, check: expectCNAME(target)})
+	}
+	return lookups, nil
+}
+
+// resolve asks the /dns endpoint of a server to resolve a name
+func resolve(ctx context.Context, cfg *Config, baseURL string, lookup dnsLookup) (*dns.Response, error) {
+	reqURL := baseURL + "/dns?" + url.Values{"name": {lookup.name}, "type": {lookup.recordType}}.Encode()
+	RecordURL(ctx, reqURL)
+	resp, err := httpGet(ctx, cfg.HTTP, reqURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to %s", reqURL)
+	}
+	defer resp.Body.Close()
+	RecordResponse(ctx, reqURL, resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read body from %s", reqURL)
+	}
+	// A failed lookup is a 502, but still describes the lookup
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadGateway {
+		return nil, fmt.Errorf("%s returned non-200 error code %d: %s", reqURL, resp.StatusCode, string(body))
+	}
+	var dnsResp dns.Response
+	err = json.Unmarshal(body, &dnsResp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse response from %s", reqURL)
+	}
+	return &dnsResp, nil
+}
+
+// describeAnswer summarizes the answer to a lookup on a single line
+func describeAnswer(resp *dns.Response) string {
+	var answers []string
+	answers = append(answers, resp.Addresses...)
+	for _, srv := range resp.SRV {
+		answers = append(answers, fmt.Sprintf("%s:%d", srv.Target, srv.Port))
+	}
+	answer := strings.Join(answers, ",")
+	if resp.CNAME != "" && strings.TrimSuffix(resp.CNAME, ".") != strings.TrimSuffix(resp.Name, ".") {
+		answer = fmt.Sprintf("%s (CNAME %s)", answer, resp.CNAME)
+	}
+	return answer
+}
+
+// TestDNS resolves the names from dnsLookups from inside a Deployment pod and the StatefulSet pod, using their /dns endpoints.
+// The answer and latency of each lookup, and the search domains and ndots of each pod, are recorded as details of the result.
+// Every lookup is made even if some fail, and the error lists every failed lookup.
+func TestDNS(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string, deploymentPod *corev1.Pod) error {
+	lookups, err := dnsLookups(ctx, cfg, k8sClient, fullname)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, podName := range []string{deploymentPod.Name, fullname + "-0"} {
+		err := withPortForward(ctx, cfg, podName, serverPort, func(baseURL string) error {
+			for ix, lookup := range lookups {
+				resp, err := resolve(ctx, cfg, baseURL, lookup)
+				if err != nil {
+					return err
+				}
+				if ix == 0 {
+					conf := resp.ResolvConf
+					RecordDetail(ctx, podName+" resolv.conf", fmt.Sprintf("search %s ndots:%d", strings.Join(conf.Search, " "), conf.Ndots))
+				}
+				key := fmt.Sprintf("%s %s %s", podName, lookup.recordType, lookup.name)
+				latency := time.Duration(resp.DurationSeconds * float64(time.Second)).Round(time.Microsecond)
+				search := ""
+				if resp.SearchFirst {
+					search = ", search domains tried first"
+				}
+				reason := resp.Error
+				if reason == "" {
+					reason = lookup.check(resp)
+				}
+				if reason != "" {
+					RecordDetail(ctx, key, fmt.Sprintf("failed (%s%s): %s", latency, search, reason))
+					failures = append(failures, fmt.Sprintf("%s %s from %s %s", lookup.recordType, lookup.name, podName, reason))
+					continue
+				}
+				RecordDetail(ctx, key, fmt.Sprintf("%s (%s%s)", describeAnswer(resp), latency, search))
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "Failed to resolve names from pod %s", podName)
+		}
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("%d of %d DNS lookups failed: %s", len(failures), 2*len(lookups), strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/dns"
+)
+
+// dnsObjects are the objects of a release named smoke that dnsLookups inspects, which can be modified by each test
+func dnsObjects(modify ...func(deployment, headless *corev1.Service, pod *corev1.Pod)) []runtime.Object {
+	httpPort := []corev1.ServicePort{{Name: "http", Port: 8080}}
+	deployment := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "smoke-deployment", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.20", ClusterIPs: []string{"10.96.0.20"}, Ports: httpPort},
+	}
+	headless := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "smoke-statefulset-headless", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Ports: httpPort},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "smoke-0", Namespace: "default"},
+		Spec:       corev1.PodSpec{Hostname: "smoke-0", Subdomain: "smoke-statefulset"},
+		Status:     corev1.PodStatus{PodIPs: []corev1.PodIP{{IP: "10.244.0.5"}}},
+	}
+	for _, f := range modify {
+		f(deployment, headless, pod)
+	}
+	return []runtime.Object{deployment, headless, pod}
+}
+
+func dualStack(deployment, headless *corev1.Service, pod *corev1.Pod) {
+	deployment.Spec.ClusterIPs = append(deployment.Spec.ClusterIPs, "fd00::20")
+	pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: "fd00:244::5"})
+}
+
+func dnsTestConfig(values DNSValues) *Config {
+	return &Config{ReleaseNamespace: "default", MergedValues: &MergedValues{DNS: values}}
+}
+
+// lookupKeys describes each lookup as its record type and name, in order
+func lookupKeys(lookups []dnsLookup) []string {
+	keys := make([]string, 0, len(lookups))
+	for _, lookup := range lookups {
+		keys = append(keys, lookup.recordType+" "+lookup.name)
+	}
+	return keys
+}
+
+var _ = ginkgo.Describe("dnsLookups", func() {
+	disabled := false
+
+	ginkgo.It("should resolve the Services, the per-pod name and the ExternalName Service over IPv4", func(ctx ginkgo.SpecContext) {
+		lookups, err := dnsLookups(ctx, dnsTestConfig(DNSValues{}), fake.NewSimpleClientset(dnsObjects()...), "smoke")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lookupKeys(lookups)).To(Equal([]string{
+			"A smoke-deployment",
+			"A smoke-deployment.default",
+			"A smoke-deployment.default.svc",
+			"A smoke-deployment.default.svc.cluster.local",
+			"A smoke-deployment.default.svc.cluster.local.",
+			"A smoke-statefulset-headless.default.svc.cluster.local.",
+			"A smoke-0.smoke-statefulset",
+			"A smoke-0.smoke-statefulset.default.svc.cluster.local.",
+			"SRV _http._tcp.smoke-deployment.default.svc.cluster.local.",
+			"SRV _http._tcp.smoke-statefulset-headless.default.svc.cluster.local.",
+			"A smoke-external.default.svc.cluster.local.",
+		}))
+	})
+
+	ginkgo.It("should add AAAA lookups for dual-stack Services, and use the cluster domain", func(ctx ginkgo.SpecContext) {
+		cfg := dnsTestConfig(DNSValues{ClusterDomain: "example.internal", ExternalName: DNSExternalNameValues{Enabled: &disabled}})
+		lookups, err := dnsLookups(ctx, cfg, fake.NewSimpleClientset(dnsObjects(dualStack)...), "smoke")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(lookupKeys(lookups)).To(Equal([]string{
+			"A smoke-deployment",
+			"A smoke-deployment.default",
+			"A smoke-deployment.default.svc",
+			"A smoke-deployment.default.svc.example.internal",
+			"A smoke-deployment.default.svc.example.internal.",
+			"A smoke-statefulset-headless.default.svc.example.internal.",
+			"A smoke-0.smoke-statefulset",
+			"A smoke-0.smoke-statefulset.default.svc.example.internal.",
+			"AAAA smoke-deployment",
+			"AAAA smoke-deployment.default",
+			"AAAA smoke-deployment.default.svc",
+			"AAAA smoke-deployment.default.svc.example.internal",
+			"AAAA smoke-deployment.default.svc.example.internal.",
+			"AAAA smoke-statefulset-headless.default.svc.example.internal.",
+			"AAAA smoke-0.smoke-statefulset",
+			"AAAA smoke-0.smoke-statefulset.default.svc.example.internal.",
+			"SRV _http._tcp.smoke-deployment.default.svc.example.internal.",
+			"SRV _http._tcp.smoke-statefulset-headless.default.svc.example.internal.",
+		}))
+	})
+
+	ginkgo.DescribeTable("checking the answers",
+		func(ctx ginkgo.SpecContext, values DNSValues, key string, resp *dns.Response, expectWrong bool) {
+			lookups, err := dnsLookups(ctx, dnsTestConfig(values), fake.NewSimpleClientset(dnsObjects(dualStack)...), "smoke")
+			Expect(err).ToNot(HaveOccurred())
+			keys := lookupKeys(lookups)
+			Expect(keys).To(ContainElement(key))
+			for ix := range keys {
+				if keys[ix] != key {
+					continue
+				}
+				if expectWrong {
+					Expect(lookups[ix].check(resp)).ToNot(BeEmpty())
+				} else {
+					Expect(lookups[ix].check(resp)).To(BeEmpty())
+				}
+			}
+		},
+		ginkgo.Entry("Service cluster IP", DNSValues{}, "A smoke-deployment",
+			&dns.Response{Addresses: []string{"10.96.0.20"}}, false),
+		ginkgo.Entry("wrong Service IP", DNSValues{}, "A smoke-deployment",
+			&dns.Response{Addresses: []string{"10.96.0.21"}}, true),
+		ginkgo.Entry("Service IPv6 cluster IP", DNSValues{}, "AAAA smoke-deployment.default.svc.cluster.local.",
+			&dns.Response{Addresses: []string{"fd00::20"}}, false),
+		ginkgo.Entry("IPv4 address for an AAAA lookup", DNSValues{}, "AAAA smoke-deployment.default.svc.cluster.local.",
+			&dns.Response{Addresses: []string{"10.96.0.20"}}, true),
+		ginkgo.Entry("per-pod name", DNSValues{}, "A smoke-0.smoke-statefulset",
+			&dns.Response{Addresses: []string{"10.244.0.5"}}, false),
+		ginkgo.Entry("headless Service resolving to the Service IP", DNSValues{}, "A smoke-statefulset-headless.default.svc.cluster.local.",
+			&dns.Response{Addresses: []string{"10.96.0.20"}}, true),
+		ginkgo.Entry("SRV record for the http port", DNSValues{}, "SRV _http._tcp.smoke-deployment.default.svc.cluster.local.",
+			&dns.Response{SRV: []dns.SRV{{Target: "smoke-deployment.default.svc.cluster.local.", Port: 8080}}}, false),
+		ginkgo.Entry("SRV record for another port", DNSValues{}, "SRV _http._tcp.smoke-deployment.default.svc.cluster.local.",
+			&dns.Response{SRV: []dns.SRV{{Target: "smoke-deployment.default.svc.cluster.local.", Port: 80}}}, true),
+		ginkgo.Entry("ExternalName default target", DNSValues{}, "A smoke-external.default.svc.cluster.local.",
+			&dns.Response{CNAME: "kubernetes.default.svc.cluster.local.", Addresses: []string{"10.96.0.1"}}, false),
+		ginkgo.Entry("ExternalName target", DNSValues{ExternalName: DNSExternalNameValues{Target: "example.com"}}, "A smoke-external.default.svc.cluster.local.",
+			&dns.Response{CNAME: "example.com.", Addresses: []string{"192.0.2.1"}}, false),
+		ginkgo.Entry("ExternalName resolving to another target", DNSValues{}, "A smoke-external.default.svc.cluster.local.",
+			&dns.Response{CNAME: "example.com.", Addresses: []string{"192.0.2.1"}}, true),
+		ginkgo.Entry("ExternalName resolving to no addresses", DNSValues{}, "A smoke-external.default.svc.cluster.local.",
+			&dns.Response{CNAME: "kubernetes.default.svc.cluster.local."}, true),
+	)
+
+	ginkgo.DescribeTable("invalid objects",
+		func(ctx ginkgo.SpecContext, objects []runtime.Object, expectedErr string) {
+			_, err := dnsLookups(ctx, dnsTestConfig(DNSValues{}), fake.NewSimpleClientset(objects...), "smoke")
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		ginkgo.Entry("missing Deployment Service", dnsObjects()[1:], "Failed to get Service smoke-deployment"),
+		ginkgo.Entry("missing headless Service",
+			[]runtime.Object{dnsObjects()[0], dnsObjects()[2]},
+			"Failed to get Service smoke-statefulset-headless",
+		),
+		ginkgo.Entry("missing StatefulSet pod", dnsObjects()[:2], "Failed to get StatefulSet pod smoke-0"),
+		ginkgo.Entry("no http port",
+			dnsObjects(func(deployment, headless *corev1.Service, pod *corev1.Pod) { deployment.Spec.Ports[0].Name = "web" }),
+			"Service smoke-deployment has no port named http",
+		),
+		ginkgo.Entry("no subdomain",
+			dnsObjects(func(deployment, headless *corev1.Service, pod *corev1.Pod) { pod.Spec.Subdomain = "" }),
+			"StatefulSet pod smoke-0 has no subdomain",
+		),
+		ginkgo.Entry("no cluster IPs",
+			dnsObjects(func(deployment, headless *corev1.Service, pod *corev1.Pod) {
+				deployment.Spec.ClusterIP = corev1.ClusterIPNone
+				deployment.Spec.ClusterIPs = []string{corev1.ClusterIPNone}
+			}),
+			"Service smoke-deployment has no cluster IPs",
+		),
+	)
+})
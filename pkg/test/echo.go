@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+)
+
+// forwardedHeaders are the headers set by proxies which are recorded by checks that use the /echo endpoint
+var forwardedHeaders = []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-Ip", "Forwarded"}
+
+// errNoEcho is returned by getEcho if the server responds with 404, as images built before the /echo endpoint was added do
+var errNoEcho = errors.New("Server has no /echo endpoint")
+
+// getEcho sends a request to the /echo endpoint of a server, and parses what it observed
+func getEcho(ctx context.Context, client *http.Client, req *http.Request) (*echo.Response, error) {
+	echoURL := req.URL.String()
+	RecordURL(ctx, echoURL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to %s", echoURL)
+	}
+	defer resp.Body.Close()
+	RecordResponse(ctx, echoURL, resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read body from %s", echoURL)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.Wrapf(errNoEcho, "%s returned 404", echoURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned non-200 error code %d: %s", echoURL, resp.StatusCode, string(body))
+	}
+	var echoResp echo.Response
+	err = json.Unmarshal(body, &echoResp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse response from %s", echoURL)
+	}
+	return &echoResp, nil
+}
+
+// getEchoURL is getEcho for a GET request to a base URL
+func getEchoURL(ctx context.Context, client *http.Client, baseURL string) (*echo.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/echo", nil)
+	if err != nil {
+		return nil, err
+	}
+	return getEcho(ctx, client, req)
+}
+
+// expectServedBy requests the /echo endpoint of a base URL, and checks that the request was served by a pod.
+// Servers which have no /echo endpoint, or which do not know their pod name, are not checked, so that older images can still be tested.
+func expectServedBy(ctx context.Context, cfg *Config, baseURL, podName string) error {
+	resp, err := getEchoURL(ctx, cfg.HTTP, baseURL)
+	if errors.Is(err, errNoEcho) {
+		log.Printf("Not checking which pod served the request to pod %s: %s", podName, err)
+		RecordDetail(ctx, "servedBy", "unknown, the server has no /echo endpoint")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Pod.Name == "" {
+		log.Printf("Not checking which pod served the request to pod %s: the server does not know its pod name", podName)
+		RecordDetail(ctx, "servedBy", "unknown, POD_NAME is not set")
+		return nil
+	}
+	if resp.Pod.Name != podName {
+		return fmt.Errorf("Request to pod %s was served by pod %s", podName, resp.Pod.Name)
+	}
+	return nil
+}
+
+// TestIngressEcho sends a request to the /echo endpoint through the ingress, and checks that it was served by a ready pod of the Deployment.
+// If IngressRequireForwardedHeaders is set, it also checks that the ingress controller set X-Forwarded-For or Forwarded.
+// The pod, node, client IP and forwarding headers observed by the pod are recorded as details of the result.
+func TestIngressEcho(ctx context.Context, cfg *Config, client *http.Client, deploymentPods []corev1.Pod) error {
+	req, err := cfg.ingressRequest(ctx, "/echo")
+	if err != nil {
+		return err
+	}
+	resp, err := getEcho(ctx, client, req)
+	if err != nil {
+		return err
+	}
+	RecordDetail(ctx, "pod", resp.Pod.Name)
+	RecordDetail(ctx, "node", resp.Pod.Node)
+	RecordDetail(ctx, "clientIP", resp.ClientIP)
+	for _, header := range forwardedHeaders {
+		if value := resp.Headers.Get(header); value != "" {
+			RecordDetail(ctx, header, value)
+		}
+	}
+
+	served := false
+	for _, pod := range deploymentPods {
+		if pod.Name == resp.Pod.Name {
+			served = true
+			break
+		}
+	}
+	if !served {
+		return fmt.Errorf("Ingress request was served by %s, which is not a ready pod of the Deployment", resp.Pod.Name)
+	}
+	if resp.Headers.Get("X-Forwarded-For") != "" || resp.Headers.Get("Forwarded") != "" {
+		return nil
+	}
+	if cfg.IngressRequireForwardedHeaders {
+		return fmt.Errorf("Ingress did not set X-Forwarded-For or Forwarded on the request to pod %s", resp.Pod.Name)
+	}
+	RecordDetail(ctx, "forwardedHeaders", "none")
+	return nil
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/echo"
+)
+
+// serveEchoHandler responds to every request as the /echo endpoint of a pod would
+func serveEchoHandler(podName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(echo.Response{Pod: echo.PodInfo{Name: podName}})
+	}
+}
+
+var _ = ginkgo.Describe("expectServedBy", func() {
+	serve := func(handler http.HandlerFunc) *httptest.Server {
+		srv := httptest.NewServer(handler)
+		ginkgo.DeferCleanup(srv.Close)
+		return srv
+	}
+
+	ginkgo.DescribeTable("checking the serving pod",
+		func(ctx ginkgo.SpecContext, handler http.HandlerFunc, expectErr bool) {
+			srv := serve(handler)
+			err := expectServedBy(ctx, &Config{HTTP: srv.Client()}, srv.URL, "pod-0")
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		},
+		ginkgo.Entry("served by the pod", serveEchoHandler("pod-0"), false),
+		ginkgo.Entry("served by another pod", serveEchoHandler("pod-1"), true),
+		ginkgo.Entry("server without POD_NAME", serveEchoHandler(""), false),
+		ginkgo.Entry("server without /echo", http.HandlerFunc(http.NotFound), false),
+		ginkgo.Entry("server error", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}), true),
+	)
+})
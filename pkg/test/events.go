@@ -0,0 +1,179 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// ResultEvents is the name of the result recorded for the events watched while the checks executed, if Config.Events is set
+const ResultEvents = "events"
+
+// EventsMode is what to do when a warning event with a denylisted reason involves an object of the release
+type EventsMode string
+
+const (
+	// EventsOff does not watch events. The zero value is equivalent.
+	EventsOff EventsMode = "off"
+	// EventsWarn logs the events and records them in the report, but does not fail
+	EventsWarn EventsMode = "warn"
+	// EventsFail fails the test
+	EventsFail EventsMode = "fail"
+)
+
+// EventsModes are all supported events modes
+var EventsModes = []EventsMode{EventsOff, EventsWarn, EventsFail}
+
+// DefaultEventReasons are the reasons of warning events that indicate a degraded cluster, used if Config.EventReasons is empty
+var DefaultEventReasons = []string{
+	"FailedScheduling",
+	"FailedMount",
+	"FailedAttachVolume",
+	"ProvisioningFailed",
+	"FailedCreatePodSandBox",
+	"BackOff",
+	"Evicted",
+}
+
+// nameSuffixChars are the characters Kubernetes uses in the random suffixes and pod template hashes of generated pod names
+const nameSuffixChars = "[bcdfghjklmnpqrstvwxz2456789]"
+
+// releaseObjectNames returns patterns matching the exact names of the objects of the release whose events are watched, by kind.
+// Pods are those of the StatefulSet, by ordinal, of the DaemonSet and Job, by random suffix, and of the Deployment, by pod template hash and random suffix.
+// PVCs are the RWX PVC and those created from the StatefulSet's volumeClaimTemplates.
+// Matching exact names, rather than any name containing the fullname, excludes the objects of other releases whose fullname starts with this one's.
+func releaseObjectNames(fullname string) map[string]*regexp.Regexp {
+	name := regexp.QuoteMeta(fullname)
+	return map[string]*regexp.Regexp{
+		"Pod":                   regexp.MustCompile(fmt.Sprintf(`^%s-([0-9]+|%s{5}|%s{6,10}-%s{5})$`, name, nameSuffixChars, nameSuffixChars, nameSuffixChars)),
+		"PersistentVolumeClaim": regexp.MustCompile(fmt.Sprintf(`^(%s-rwx|rwo-%s-[0-9]+)$`, name, name)),
+		"Service":               regexp.MustCompile(fmt.Sprintf(`^%s-(deployment|statefulset|statefulset-headless|daemonset|external)$`, name)),
+		"Ingress":               regexp.MustCompile(fmt.Sprintf(`^%s$`, name)),
+	}
+}
+
+// isReleaseObject returns true if an object is one of those matched by releaseObjectNames
+func isReleaseObject(names map[string]*regexp.Regexp, object corev1.ObjectReference) bool {
+	pattern, ok := names[object.Kind]
+	return ok && pattern.MatchString(object.Name)
+}
+
+// eventWatcher collects the denylisted warning events involving the release from when it is started until it is stopped
+type eventWatcher struct {
+	start   time.Time
+	watcher *watchtools.RetryWatcher
+	done    chan struct{}
+
+	lock   sync.Mutex
+	order  []types.UID
+	events map[types.UID]*corev1.Event
+}
+
+func (cfg *Config) eventReasons() map[string]bool {
+	reasons := cfg.EventReasons
+	if len(reasons) == 0 {
+		reasons = DefaultEventReasons
+	}
+	set := make(map[string]bool, len(reasons))
+	for _, reason := range reasons {
+		set[reason] = true
+	}
+	return set
+}
+
+// watchEvents starts watching the events in the release namespace. Only events that occur after it is called are collected.
+// The objects of the release are told apart from other objects in the namespace by their names, see releaseObjectNames.
+func watchEvents(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string) (*eventWatcher, error) {
+	events := k8sClient.CoreV1().Events(cfg.ReleaseNamespace)
+	list, err := events.List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to list events")
+	}
+	watcher, err := watchtools.NewRetryWatcher(list.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return events.Watch(ctx, opts)
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to watch events")
+	}
+	w := &eventWatcher{
+		start:   time.Now(),
+		watcher: watcher,
+		done:    make(chan struct{}),
+		events:  make(map[types.UID]*corev1.Event),
+	}
+	reasons := cfg.eventReasons()
+	names := releaseObjectNames(fullname)
+	go func() {
+		defer close(w.done)
+		for ev := range watcher.ResultChan() {
+			if ev.Type != watch.Added && ev.Type != watch.Modified {
+				continue
+			}
+			event, ok := ev.Object.(*corev1.Event)
+			if !ok || event.Type != corev1.EventTypeWarning || !reasons[event.Reason] {
+				continue
+			}
+			if !isReleaseObject(names, event.InvolvedObject) {
+				continue
+			}
+			w.add(event)
+		}
+	}()
+	return w, nil
+}
+
+func (w *eventWatcher) add(event *corev1.Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.events[event.UID]; !ok {
+		w.order = append(w.order, event.UID)
+	}
+	w.events[event.UID] = event
+}
+
+// stop stops watching, and returns the outcome according to mode.
+// Each event is recorded as a detail of the result, keyed by the object and reason.
+func (w *eventWatcher) stop(mode EventsMode) *Result {
+	w.watcher.Stop()
+	<-w.done
+
+	result := &Result{Name: ResultEvents, Start: w.start, Duration: time.Since(w.start), Status: StatusPassed}
+	var descriptions []string
+	for _, uid := range w.order {
+		event := w.events[uid]
+		object := fmt.Sprintf("%s/%s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name)
+		message := strings.TrimSpace(event.Message)
+		if event.Count > 1 {
+			message = fmt.Sprintf("%s (x%d)", message, event.Count)
+		}
+		result.setDetail(fmt.Sprintf("%s %s", object, event.Reason), message)
+		descriptions = append(descriptions, fmt.Sprintf("%s %s: %s", object, event.Reason, message))
+	}
+	if len(descriptions) == 0 {
+		return result
+	}
+	err := fmt.Errorf("Warning events involved the release: %s", strings.Join(descriptions, "; "))
+	if mode == EventsFail {
+		result.Status = StatusFailed
+		result.Error = err
+		return result
+	}
+	log.Printf("Warning: %s", err)
+	return result
+}
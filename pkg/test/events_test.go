@@ -0,0 +1,31 @@
+package test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.DescribeTable("isReleaseObject",
+	func(kind, name string, expected bool) {
+		names := releaseObjectNames("smoke-k8s-smoke-test")
+		Expect(isReleaseObject(names, corev1.ObjectReference{Kind: kind, Name: name})).To(Equal(expected))
+	},
+	ginkgo.Entry("StatefulSet pod", "Pod", "smoke-k8s-smoke-test-0", true),
+	ginkgo.Entry("Deployment pod", "Pod", "smoke-k8s-smoke-test-7d9f8b6c5d-x2x4q", true),
+	ginkgo.Entry("DaemonSet or Job pod", "Pod", "smoke-k8s-smoke-test-hz8vb", true),
+	ginkgo.Entry("RWX PVC", "PersistentVolumeClaim", "smoke-k8s-smoke-test-rwx", true),
+	ginkgo.Entry("RWO PVC", "PersistentVolumeClaim", "rwo-smoke-k8s-smoke-test-0", true),
+	ginkgo.Entry("StatefulSet Service", "Service", "smoke-k8s-smoke-test-statefulset", true),
+	ginkgo.Entry("headless Service", "Service", "smoke-k8s-smoke-test-statefulset-headless", true),
+	ginkgo.Entry("Ingress", "Ingress", "smoke-k8s-smoke-test", true),
+	ginkgo.Entry("StatefulSet pod of a release with a longer fullname", "Pod", "smoke-k8s-smoke-test-bar-0", false),
+	ginkgo.Entry("Deployment pod of a release with a longer fullname", "Pod", "smoke-k8s-smoke-test-bar-7d9f8b6c5d-x2x4q", false),
+	ginkgo.Entry("DaemonSet pod of a release with a longer fullname", "Pod", "smoke-k8s-smoke-test-2-hz8vb", false),
+	ginkgo.Entry("RWO PVC of a release with a longer fullname", "PersistentVolumeClaim", "rwo-smoke-k8s-smoke-test-bar-0", false),
+	ginkgo.Entry("Service of a release with a longer fullname", "Service", "smoke-k8s-smoke-test-bar-deployment", false),
+	ginkgo.Entry("Ingress of a release with a longer fullname", "Ingress", "smoke-k8s-smoke-test-bar", false),
+	ginkgo.Entry("object containing the fullname", "Pod", "other-smoke-k8s-smoke-test-0", false),
+	ginkgo.Entry("unwatched kind", "Node", "smoke-k8s-smoke-test", false),
+)
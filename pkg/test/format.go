@@ -0,0 +1,260 @@
+package test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportFormat is a format that a report can be serialized to
+type ReportFormat string
+
+const (
+	// ReportFormatJUnit is JUnit XML, as understood by most CI systems
+	ReportFormatJUnit ReportFormat = "junit"
+	// ReportFormatJSON is a JSON object with one entry per check
+	ReportFormatJSON ReportFormat = "json"
+	// ReportFormatTAP is the Test Anything Protocol, version 13
+	ReportFormatTAP ReportFormat = "tap"
+)
+
+// ReportFormats are all supported report formats
+var ReportFormats = []ReportFormat{ReportFormatJUnit, ReportFormatJSON, ReportFormatTAP}
+
+// Write serializes the report in the given format
+func (r *Report) Write(w io.Writer, format ReportFormat) error {
+	switch format {
+	case ReportFormatJUnit:
+		return r.WriteJUnit(w)
+	case ReportFormatJSON:
+		return r.WriteJSON(w)
+	case ReportFormatTAP:
+		return r.WriteTAP(w)
+	default:
+		return fmt.Errorf("Unsupported report format %s, must be one of %v", format, ReportFormats)
+	}
+}
+
+type jsonReport struct {
+	Start           time.Time    `json:"start"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Passed          bool         `json:"passed"`
+	DiagnosticsPath string       `json:"diagnosticsPath,omitempty"`
+	Results         []jsonResult `json:"results"`
+}
+
+type jsonResult struct {
+	Name            string            `json:"name"`
+	Status          Status            `json:"status"`
+	Start           *time.Time        `json:"start,omitempty"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Error           string            `json:"error,omitempty"`
+	SkipReason      string            `json:"skipReason,omitempty"`
+	URLs            []string          `json:"urls,omitempty"`
+	Details         map[string]string `json:"details,omitempty"`
+	Attempts        []jsonAttempt     `json:"attempts,omitempty"`
+}
+
+type jsonAttempt struct {
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// WriteJSON serializes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := jsonReport{
+		Start:           r.Start,
+		DurationSeconds: r.Duration.Seconds(),
+		Passed:          r.Passed(),
+		DiagnosticsPath: r.DiagnosticsPath,
+		Results:         make([]jsonResult, 0, len(r.Results)),
+	}
+	for _, result := range r.Results {
+		jResult := jsonResult{
+			Name:            result.Name,
+			Status:          result.Status,
+			DurationSeconds: result.Duration.Seconds(),
+			SkipReason:      result.SkipReason,
+			URLs:            result.URLs,
+			Details:         result.Details,
+		}
+		if !result.Start.IsZero() {
+			start := result.Start
+			jResult.Start = &start
+		}
+		if result.Error != nil {
+			jResult.Error = result.Error.Error()
+		}
+		for _, attempt := range result.Attempts {
+			jAttempt := jsonAttempt{Start: attempt.Start, DurationSeconds: attempt.Duration.Seconds()}
+			if attempt.Error != nil {
+				jAttempt.Error = attempt.Error.Error()
+			}
+			jResult.Attempts = append(jResult.Attempts, jAttempt)
+		}
+		out.Results = append(out.Results, jResult)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	Classname  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit serializes the report as JUnit XML, with one test case per check
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      "k8s-smoke-test",
+		Tests:     len(r.Results),
+		Failures:  r.Count(StatusFailed),
+		Skipped:   r.Count(StatusSkipped),
+		Time:      junitSeconds(r.Duration),
+		Timestamp: r.Start.Format(time.RFC3339),
+		Cases:     make([]junitTestCase, 0, len(r.Results)),
+	}
+	for _, result := range r.Results {
+		testCase := junitTestCase{
+			Name:      result.Name,
+			Classname: "k8s-smoke-test",
+			Time:      junitSeconds(result.Duration),
+			SystemOut: strings.Join(result.URLs, "\n"),
+		}
+		if len(result.Details) != 0 || len(result.Attempts) > 1 {
+			testCase.Properties = &junitProperties{}
+			for _, key := range sortedKeys(result.Details) {
+				testCase.Properties.Properties = append(testCase.Properties.Properties, junitProperty{Name: key, Value: result.Details[key]})
+			}
+			if len(result.Attempts) > 1 {
+				for ix, attempt := range result.Attempts {
+					testCase.Properties.Properties = append(testCase.Properties.Properties, junitProperty{Name: fmt.Sprintf("attempt-%d", ix+1), Value: attempt.summary()})
+				}
+			}
+		}
+		switch result.Status {
+		case StatusFailed:
+			testCase.Failure = &junitMessage{Message: result.Error.Error(), Body: fmt.Sprintf("%+v", result.Error)}
+		case StatusSkipped:
+			testCase.Skipped = &junitMessage{Message: result.SkipReason}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(&junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tapYAMLString quotes a string for the YAML block of a TAP test point.
+// JSON strings are valid YAML flow scalars.
+func tapYAMLString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// WriteTAP serializes the report as TAP version 13, with one test point per check
+func (r *Report) WriteTAP(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(r.Results))
+	for ix, result := range r.Results {
+		switch result.Status {
+		case StatusPassed:
+			fmt.Fprintf(&b, "ok %d - %s\n", ix+1, result.Name)
+		case StatusSkipped:
+			fmt.Fprintf(&b, "ok %d - %s # SKIP %s\n", ix+1, result.Name, result.SkipReason)
+			continue
+		case StatusFailed:
+			fmt.Fprintf(&b, "not ok %d - %s\n", ix+1, result.Name)
+		}
+		b.WriteString("  ---\n")
+		fmt.Fprintf(&b, "  duration_ms: %d\n", result.Duration.Milliseconds())
+		if result.Error != nil {
+			fmt.Fprintf(&b, "  message: %s\n", tapYAMLString(result.Error.Error()))
+		}
+		if len(result.URLs) != 0 {
+			b.WriteString("  urls:\n")
+			for _, url := range result.URLs {
+				fmt.Fprintf(&b, "    - %s\n", tapYAMLString(url))
+			}
+		}
+		if len(result.Details) != 0 {
+			b.WriteString("  details:\n")
+			for _, key := range sortedKeys(result.Details) {
+				fmt.Fprintf(&b, "    %s: %s\n", tapYAMLString(key), tapYAMLString(result.Details[key]))
+			}
+		}
+		if len(result.Attempts) > 1 {
+			b.WriteString("  attempts:\n")
+			for _, attempt := range result.Attempts {
+				fmt.Fprintf(&b, "    - %s\n", tapYAMLString(attempt.summary()))
+			}
+		}
+		b.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "Overwrite the golden report files in testdata with the current output")
+
+// goldenReport has a passed, a failed, and a skipped result, with values that need escaping in each format
+func goldenReport() *Report {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Report{
+		Start:    start,
+		Duration: 3500 * time.Millisecond,
+		Results: []*Result{
+			{
+				Name:     "ingress",
+				Status:   StatusPassed,
+				Start:    start,
+				Duration: 1250 * time.Millisecond,
+				URLs:     []string{"https://smoke.example.com/rwx/test?a=1&b=2"},
+				Details:  map[string]string{"subject": `CN=smoke.example.com, O="Example: Inc"`, "issuer": "CN=<test CA>"},
+			},
+			{
+				Name:     "loadbalancer",
+				Status:   StatusFailed,
+				Start:    start.Add(1250 * time.Millisecond),
+				Duration: 2 * time.Second,
+				Error:    errors.New("LoadBalancer has no ingresses:\n\"pending\""),
+				Attempts: []Attempt{
+					{Start: start.Add(1250 * time.Millisecond), Duration: 500 * time.Millisecond, Error: errors.New("not yet")},
+					{Start: start.Add(2250 * time.Millisecond), Duration: time.Second, Error: errors.New("LoadBalancer has no ingresses:\n\"pending\"")},
+				},
+			},
+			{
+				Name:       "rwo",
+				Status:     StatusSkipped,
+				SkipReason: "RWO persistence is disabled by persistence.rwo.enabled",
+			},
+		},
+	}
+}
+
+var _ = ginkgo.DescribeTable("Report.Write",
+	func(format ReportFormat, golden string) {
+		var buf bytes.Buffer
+		Expect(goldenReport().Write(&buf, format)).To(Succeed())
+		path := filepath.Join("testdata", golden)
+		if *updateGolden {
+			Expect(os.WriteFile(path, buf.Bytes(), 0o644)).To(Succeed())
+		}
+		expected, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buf.String()).To(Equal(string(expected)))
+	},
+	ginkgo.Entry("JUnit", ReportFormatJUnit, "report.xml"),
+	ginkgo.Entry("JSON", ReportFormatJSON, "report.json"),
+	ginkgo.Entry("TAP", ReportFormatTAP, "report.tap"),
+)
+
+var _ = ginkgo.DescribeTable("tapYAMLString",
+	func(s, expected string) {
+		Expect(tapYAMLString(s)).To(Equal(expected))
+	},
+	ginkgo.Entry("plain", "plain", `"plain"`),
+	ginkgo.Entry("YAML indicators", "key: - value #comment", `"key: - value #comment"`),
+	ginkgo.Entry("quotes", `say "hi"`, `"say \"hi\""`),
+	ginkgo.Entry("newlines", "line 1\nline 2", `"line 1\nline 2"`),
+	ginkgo.Entry("empty", "", `""`),
+)
+
+var _ = ginkgo.It("should reject unsupported report formats", func() {
+	Expect(goldenReport().Write(&bytes.Buffer{}, "yaml")).To(MatchError(ContainSubstring("Unsupported report format yaml")))
+})
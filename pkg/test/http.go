@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPOptions are the TLS options for the HTTP client used to contact the services
+type HTTPOptions struct {
+	// CAFile is the path to a PEM bundle of additional certificate authorities to trust, on top of the system's
+	CAFile string
+	// ClientCertFile is the path to a PEM client certificate to present, for ingress controllers which require mTLS
+	ClientCertFile string
+	// ClientKeyFile is the path to the PEM private key of ClientCertFile
+	ClientKeyFile string
+	// ServerName overrides the TLS server name (SNI) and the name the server certificate is verified against
+	ServerName string
+	// InsecureSkipVerify disables verification of server certificates
+	InsecureSkipVerify bool
+}
+
+// Client creates an HTTP client with these options, which otherwise behaves like http.DefaultClient, including honoring proxy environment variables
+func (o *HTTPOptions) Client() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		caPEM, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read CA file")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, errors.New("A client certificate and key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCertFile, o.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// cloneTransport returns a copy of the transport of an HTTP client that can be modified without affecting the original
+func cloneTransport(client *http.Client) (*http.Transport, error) {
+	switch transport := client.Transport.(type) {
+	case nil:
+		return http.DefaultTransport.(*http.Transport).Clone(), nil
+	case *http.Transport:
+		return transport.Clone(), nil
+	default:
+		return nil, fmt.Errorf("HTTP client transport must be an *http.Transport, got %T", client.Transport)
+	}
+}
+
+// withTransport returns a shallow copy of an HTTP client using a different transport
+func withTransport(client *http.Client, transport *http.Transport) *http.Client {
+	clone := *client
+	clone.Transport = transport
+	return &clone
+}
+
+// pinDial modifies a transport to connect to address for any connection to host, regardless of what it resolves to.
+// address may omit the port, in which case the port being dialed is kept.
+// This does not apply to requests sent through a proxy.
+func pinDial(transport *http.Transport, host, address string) {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialHost, dialPort, err := net.SplitHostPort(addr)
+		if err != nil || dialHost != host {
+			return dial(ctx, network, addr)
+		}
+		pinnedHost, pinnedPort, err := net.SplitHostPort(address)
+		if err != nil {
+			pinnedHost, pinnedPort = address, dialPort
+		}
+		return dial(ctx, network, net.JoinHostPort(pinnedHost, pinnedPort))
+	}
+}
+
+// ingressURLHost returns the host to put in URLs for the ingress, which is IngressHostname if set, or the ingress hostname from the values.yaml otherwise
+func (cfg *Config) ingressURLHost() string {
+	if cfg.IngressHostname != "" {
+		return cfg.IngressHostname
+	}
+	return cfg.MergedValues.Deployment.Ingress.Hostname
+}
+
+// ingressClient creates the client to use to contact the ingress, which connects to IngressAddress if set,
+// and uses the ingress hostname from the values.yaml as the TLS server name if IngressHostname is set.
+// As this creates a new transport, use Env.IngressClient to share one between checks.
+func (cfg *Config) ingressClient() (*http.Client, error) {
+	if cfg.IngressAddress == "" && cfg.IngressHostname == "" {
+		return cfg.HTTP, nil
+	}
+	transport, err := cloneTransport(cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.IngressAddress != "" {
+		pinDial(transport, cfg.ingressURLHost(), cfg.IngressAddress)
+	}
+	if cfg.IngressHostname != "" {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		if transport.TLSClientConfig.ServerName == "" {
+			transport.TLSClientConfig.ServerName = cfg.MergedValues.Deployment.Ingress.Hostname
+		}
+	}
+	return withTransport(cfg.HTTP, transport), nil
+}
+
+// httpGet is like client.Get, but the request is cancelled when ctx is done
+func httpGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// httpPost is like client.Post, but the request is cancelled when ctx is done
+func httpPost(ctx context.Context, client *http.Client, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return client.Do(req)
+}
@@ -0,0 +1,33 @@
+package test
+
+import (
+	"net/http"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Env.IngressClient", func() {
+	values := &MergedValues{Deployment: DeploymentValues{Ingress: DeploymentIngressValues{Hostname: "smoke-test.example.com"}}}
+
+	ginkgo.It("should use the HTTP client as is if the ingress is reached by its hostname", func() {
+		cfg := &Config{HTTP: &http.Client{}, MergedValues: values}
+		client, err := (&Env{Config: cfg}).IngressClient()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client).To(BeIdenticalTo(cfg.HTTP))
+	})
+
+	ginkgo.It("should create the client once, and reuse it across retries", func() {
+		cfg := &Config{HTTP: &http.Client{}, MergedValues: values, IngressHostname: "127.0.0.1.nip.io"}
+		env := &Env{Config: cfg}
+		client, err := env.IngressClient()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client).ToNot(BeIdenticalTo(cfg.HTTP))
+		Expect(client.Transport.(*http.Transport).TLSClientConfig.ServerName).To(Equal("smoke-test.example.com"))
+
+		env.invalidate()
+		again, err := env.IngressClient()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(client))
+	})
+})
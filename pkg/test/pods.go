@@ -0,0 +1,51 @@
+package test
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podIsReady returns true if a pod is Running, Ready, and not being deleted
+func podIsReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// readyPods returns the pods which are Running, Ready, and not being deleted
+func readyPods(pods []corev1.Pod) []corev1.Pod {
+	ready := make([]corev1.Pod, 0, len(pods))
+	for ix := range pods {
+		if podIsReady(&pods[ix]) {
+			ready = append(ready, pods[ix])
+		}
+	}
+	return ready
+}
+
+// onePodPerNode returns the first of a set of pods on each node, ordered by node name
+func onePodPerNode(pods []corev1.Pod) []corev1.Pod {
+	byNode := make(map[string]corev1.Pod, len(pods))
+	for _, pod := range pods {
+		if _, ok := byNode[pod.Spec.NodeName]; !ok {
+			byNode[pod.Spec.NodeName] = pod
+		}
+	}
+	nodes := make([]string, 0, len(byNode))
+	for node := range byNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	perNode := make([]corev1.Pod, 0, len(nodes))
+	for _, node := range nodes {
+		perNode = append(perNode, byNode[node])
+	}
+	return perNode
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testPod is a Running and Ready pod on a node, which can be modified by each test
+func testPod(name, node string, modify ...func(pod *corev1.Pod)) corev1.Pod {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	for _, f := range modify {
+		f(&pod)
+	}
+	return pod
+}
+
+func notReady(pod *corev1.Pod) {
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}}
+}
+
+func noReadyCondition(pod *corev1.Pod) {
+	pod.Status.Conditions = nil
+}
+
+func pending(pod *corev1.Pod) {
+	pod.Status.Phase = corev1.PodPending
+}
+
+func terminating(pod *corev1.Pod) {
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+}
+
+// podNames returns the names of pods, in order
+func podNames(pods []corev1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+var _ = ginkgo.DescribeTable("readyPods",
+	func(pods []corev1.Pod, expected []string) {
+		Expect(podNames(readyPods(pods))).To(Equal(expected))
+	},
+	ginkgo.Entry("no pods", nil, []string{}),
+	ginkgo.Entry("all ready", []corev1.Pod{testPod("a", "node-1"), testPod("b", "node-2")}, []string{"a", "b"}),
+	ginkgo.Entry("not Ready", []corev1.Pod{testPod("a", "node-1", notReady), testPod("b", "node-2")}, []string{"b"}),
+	ginkgo.Entry("no Ready condition", []corev1.Pod{testPod("a", "node-1", noReadyCondition), testPod("b", "node-2")}, []string{"b"}),
+	ginkgo.Entry("not Running", []corev1.Pod{testPod("a", "node-1", pending), testPod("b", "node-2")}, []string{"b"}),
+	ginkgo.Entry("terminating", []corev1.Pod{testPod("a", "node-1", terminating), testPod("b", "node-2")}, []string{"b"}),
+	ginkgo.Entry("none ready", []corev1.Pod{testPod("a", "node-1", notReady), testPod("b", "node-2", terminating)}, []string{}),
+)
+
+var _ = ginkgo.DescribeTable("onePodPerNode",
+	func(pods []corev1.Pod, expected []string) {
+		Expect(podNames(onePodPerNode(pods))).To(Equal(expected))
+	},
+	ginkgo.Entry("no pods", nil, []string{}),
+	ginkgo.Entry("one pod per node, ordered by node",
+		[]corev1.Pod{testPod("a", "node-2"), testPod("b", "node-1"), testPod("c", "node-3")},
+		[]string{"b", "a", "c"},
+	),
+	ginkgo.Entry("the first of multiple pods per node",
+		[]corev1.Pod{testPod("a", "node-1"), testPod("b", "node-2"), testPod("c", "node-1"), testPod("d", "node-2")},
+		[]string{"a", "b"},
+	),
+	ginkgo.Entry("ready pods only, when combined with readyPods",
+		readyPods([]corev1.Pod{testPod("a", "node-1", terminating), testPod("b", "node-1"), testPod("c", "node-2", notReady)}),
+		[]string{"b"},
+	),
+)
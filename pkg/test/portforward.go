@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serverPort is the port the deployment and statefulset servers listen on
+const serverPort = 8080
+
+// fixedPortLock serializes port-forwards which use a fixed local port, as concurrent checks would otherwise conflict over it
+var fixedPortLock sync.Mutex
+
+// withPortForward port-forwards the local port from the config to a port of a pod, and calls a function with the base URL to reach it
+func withPortForward(ctx context.Context, cfg *Config, podName string, remotePort int32, f func(baseURL string) error) error {
+	if cfg.PortForwardLocalPort != 0 {
+		fixedPortLock.Lock()
+		defer fixedPortLock.Unlock()
+	}
+	ports := []string{fmt.Sprintf("%d:%d", cfg.PortForwardLocalPort, remotePort)}
+	return portForward(ctx, cfg.K8sConfig, cfg.ReleaseNamespace, podName, ports, func(localPorts []uint16) error {
+		return f(fmt.Sprintf("http://localhost:%d", localPorts[0]))
+	})
+}
+
+// getTestFile requests the test file, or the health check if the RWX check is skipped, from a base URL
+func getTestFile(ctx context.Context, cfg *Config, errName, baseURL string) error {
+	path, expectedBody := cfg.testFilePath()
+	portForwardURL := baseURL + path
+	resp, err := httpGet(ctx, cfg.HTTP, portForwardURL)
+	return testURL(ctx, errName, portForwardURL, resp, err, expectedBody)
+}
+
+// TestPortForwardPods tests port-forwarding to each of a set of pods in turn
+func TestPortForwardPods(ctx context.Context, cfg *Config, pods []corev1.Pod) error {
+	for ix := range pods {
+		err := TestPortForward(ctx, cfg, &pods[ix])
+		if err != nil {
+			return errors.Wrapf(err, "Port-forward to pod %s on node %s failed", pods[ix].Name, pods[ix].Spec.NodeName)
+		}
+	}
+	return nil
+}
+
+// ResolveServicePod picks a pod and port to port-forward to for a Service, the same as `kubectl port-forward svc/...`.
+// The pod is the target of a ready endpoint of the Service, and the port is the target of the Service's first port.
+func ResolveServicePod(ctx context.Context, k8sClient *kubernetes.Clientset, namespace, serviceName string) (podName string, remotePort int32, err error) {
+	service, err := k8sClient.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "Failed to get Service %s", serviceName)
+	}
+	if len(service.Spec.Ports) == 0 {
+		return "", 0, fmt.Errorf("Service %s has no ports", serviceName)
+	}
+	servicePort := service.Spec.Ports[0]
+	endpoints, err := k8sClient.CoreV1().Endpoints(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "Failed to get Endpoints for Service %s", serviceName)
+	}
+	for _, subset := range endpoints.Subsets {
+		var port *corev1.EndpointPort
+		for ix := range subset.Ports {
+			if subset.Ports[ix].Name == servicePort.Name {
+				port = &subset.Ports[ix]
+				break
+			}
+		}
+		if port == nil {
+			continue
+		}
+		for _, address := range subset.Addresses {
+			if address.TargetRef == nil || address.TargetRef.Kind != "Pod" {
+				continue
+			}
+			return address.TargetRef.Name, port.Port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("Service %s has no ready endpoints backed by pods for port %s", serviceName, servicePort.Name)
+}
+
+// TestPortForwardService tests port-forwarding to the Deployment's Service
+func TestPortForwardService(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string) error {
+	serviceName := fullname + "-deployment"
+	podName, remotePort, err := ResolveServicePod(ctx, k8sClient, cfg.ReleaseNamespace, serviceName)
+	if err != nil {
+		return err
+	}
+	RecordDetail(ctx, "pod", podName)
+	return withPortForward(ctx, cfg, podName, remotePort, func(baseURL string) error {
+		err := getTestFile(ctx, cfg, fmt.Sprintf("GET Port-Forward Service %s", serviceName), baseURL)
+		if err != nil {
+			return err
+		}
+		return expectServedBy(ctx, cfg, baseURL, podName)
+	})
+}
+
+// TestPortForwardStatefulSet tests port-forwarding to the StatefulSet's pod.
+// Unless the RWO check is skipped, this also writes the test file to the pod's RWO volume and reads it back.
+func TestPortForwardStatefulSet(ctx context.Context, cfg *Config, fullname string) error {
+	podName := fullname + "-0"
+	return withPortForward(ctx, cfg, podName, serverPort, func(baseURL string) error {
+		err := getTestFile(ctx, cfg, "GET StatefulSet Port-Forward", baseURL)
+		if err != nil {
+			return err
+		}
+		err = expectServedBy(ctx, cfg, baseURL, podName)
+		if err != nil {
+			return err
+		}
+		if cfg.checkSkipReason(CheckRWO) != "" {
+			return nil
+		}
+		rwoURL := fmt.Sprintf("%s/rwo/%s", baseURL, cfg.MergedValues.TestFile.Name)
+		postResp, err := httpPost(ctx, cfg.HTTP, rwoURL, "application/octet-stream", bytes.NewBuffer([]byte(cfg.MergedValues.TestFile.Contents)))
+		err = testURL(ctx, "POST RWO StatefulSet Port-Forward", rwoURL, postResp, err, "")
+		if err != nil {
+			return err
+		}
+		getResp, err := httpGet(ctx, cfg.HTTP, rwoURL)
+		err = testURL(ctx, "GET RWO StatefulSet Port-Forward", rwoURL, getResp, err, cfg.MergedValues.TestFile.Contents)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
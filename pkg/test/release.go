@@ -0,0 +1,138 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	helmrelease "helm.sh/helm/v3/pkg/release"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/meln5674/k8s-smoke-test/pkg/release"
+)
+
+// helmReleaseSecretType is the type of secret that helm stores releases in when using the default storage driver
+const helmReleaseSecretType corev1.SecretType = "helm.sh/release.v1"
+
+// isSecretDriver returns true if a value of HELM_DRIVER selects the secret storage driver, which is the default
+func isSecretDriver(helmDriver string) bool {
+	switch helmDriver {
+	case "", "secret", "secrets":
+		return true
+	default:
+		return false
+	}
+}
+
+// GetReleaseSecret finds the secret for the latest revision of a helm release
+func GetReleaseSecret(ctx context.Context, k8sClient *kubernetes.Clientset, namespace, releaseName string) (*corev1.Secret, error) {
+	secrets, err := k8sClient.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.FormatLabels(map[string]string{"owner": "helm", "name": releaseName}),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to list secrets for helm release %s", releaseName)
+	}
+	var latest *corev1.Secret
+	latestVersion := 0
+	for ix := range secrets.Items {
+		secret := &secrets.Items[ix]
+		if secret.Type != helmReleaseSecretType {
+			continue
+		}
+		version, err := strconv.Atoi(secret.Labels["version"])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Helm release secret %s has an invalid version label", secret.Name)
+		}
+		if version > latestVersion {
+			latest = secret
+			latestVersion = version
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("No secrets for helm release %s found in namespace %s", releaseName, namespace)
+	}
+	return latest, nil
+}
+
+// DecodeReleaseValues computes the merged values (chart defaults overridden by user-supplied values)
+// from a helm release secret, equivalent to `helm get values --all -o json`
+func DecodeReleaseValues(secret *corev1.Secret) (map[string]interface{}, error) {
+	encoded, ok := secret.Data["release"]
+	if !ok {
+		return nil, fmt.Errorf("Helm release secret %s has no release key", secret.Name)
+	}
+	compressed := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(compressed, encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Helm release secret %s is not valid base64", secret.Name)
+	}
+	compressed = compressed[:n]
+	var releaseJSON io.Reader = bytes.NewReader(compressed)
+	// Helm gzips releases, but will also read them uncompressed
+	if bytes.HasPrefix(compressed, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(releaseJSON)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Helm release secret %s is not valid gzip", secret.Name)
+		}
+		defer gz.Close()
+		releaseJSON = gz
+	}
+	var rel helmrelease.Release
+	err = json.NewDecoder(releaseJSON).Decode(&rel)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Helm release secret %s does not contain a valid release", secret.Name)
+	}
+	if rel.Chart == nil {
+		return nil, fmt.Errorf("Helm release secret %s does not contain a chart", secret.Name)
+	}
+	return release.MergedValues(&rel)
+}
+
+// GetMergedValues reads the merged values of the latest revision of a helm release directly from its release secret,
+// without requiring the helm CLI.
+// Only the default secret storage driver is supported, so this fails if HELM_DRIVER selects any other.
+func GetMergedValues(ctx context.Context, k8sClient *kubernetes.Clientset, namespace, releaseName string) (*MergedValues, error) {
+	if helmDriver := os.Getenv("HELM_DRIVER"); !isSecretDriver(helmDriver) {
+		return nil, fmt.Errorf("Reading helm releases stored with HELM_DRIVER=%s is not supported, only the secret driver is. Use --merged-values-json with the output of `helm get values --all -o json` instead", helmDriver)
+	}
+	secret, err := GetReleaseSecret(ctx, k8sClient, namespace, releaseName)
+	if err != nil {
+		return nil, err
+	}
+	values, err := DecodeReleaseValues(secret)
+	if err != nil {
+		return nil, err
+	}
+	mergedValues, err := ParseMergedValues(values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse values from helm release secret %s", secret.Name)
+	}
+	return mergedValues, nil
+}
+
+// ParseMergedValues extracts the fields needed to execute the test from a complete set of helm values
+func ParseMergedValues(values map[string]interface{}) (*MergedValues, error) {
+	// Round-trip through JSON to extract only the fields we care about
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	var mergedValues MergedValues
+	err = json.Unmarshal(valuesJSON, &mergedValues)
+	if err != nil {
+		return nil, err
+	}
+	return &mergedValues, nil
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"helm.sh/helm/v3/pkg/chart"
+	helmrelease "helm.sh/helm/v3/pkg/release"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// releaseSecret encodes a release in the same manner as the helm secret storage driver
+func releaseSecret(rel *helmrelease.Release, compress bool) *corev1.Secret {
+	releaseJSON, err := json.Marshal(rel)
+	Expect(err).ToNot(HaveOccurred())
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err = gz.Write(releaseJSON)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gz.Close()).To(Succeed())
+		releaseJSON = buf.Bytes()
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1.k8s-smoke-test.v1"},
+		Type:       helmReleaseSecretType,
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(releaseJSON))},
+	}
+}
+
+func testRelease(defaults, config map[string]interface{}) *helmrelease.Release {
+	return &helmrelease.Release{
+		Name: "k8s-smoke-test",
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{Name: "k8s-smoke-test", Version: "0.1.0", APIVersion: chart.APIVersionV2},
+			Values:   defaults,
+		},
+		Config: config,
+	}
+}
+
+var _ = ginkgo.Describe("DecodeReleaseValues", func() {
+	defaults := map[string]interface{}{"image": map[string]interface{}{"repository": "k8s-smoke-test", "tag": "latest"}}
+	config := map[string]interface{}{"image": map[string]interface{}{"tag": "v1"}}
+	expected := map[string]interface{}{"image": map[string]interface{}{"repository": "k8s-smoke-test", "tag": "v1"}}
+
+	ginkgo.DescribeTable("decoding the release secret",
+		func(secret *corev1.Secret, expectErr bool) {
+			values, err := DecodeReleaseValues(secret)
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(values).To(Equal(expected))
+		},
+		ginkgo.Entry("gzipped", releaseSecret(testRelease(defaults, config), true), false),
+		ginkgo.Entry("uncompressed", releaseSecret(testRelease(defaults, config), false), false),
+		ginkgo.Entry("no release key", &corev1.Secret{Data: map[string][]byte{}}, true),
+		ginkgo.Entry("invalid base64", &corev1.Secret{Data: map[string][]byte{"release": []byte("not base64!")}}, true),
+		ginkgo.Entry("invalid gzip", &corev1.Secret{Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b, 0x00}))}}, true),
+		ginkgo.Entry("invalid release", &corev1.Secret{Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString([]byte("[]")))}}, true),
+		ginkgo.Entry("no chart", releaseSecret(&helmrelease.Release{Name: "k8s-smoke-test"}, true), true),
+	)
+
+	ginkgo.DescribeTable("merging user-supplied values over chart defaults",
+		func(defaults, config, expected map[string]interface{}) {
+			values, err := DecodeReleaseValues(releaseSecret(testRelease(defaults, config), true))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(values).To(Equal(expected))
+		},
+		ginkgo.Entry("no user-supplied values",
+			map[string]interface{}{"a": "default"},
+			nil,
+			map[string]interface{}{"a": "default"},
+		),
+		ginkgo.Entry("scalar overrides default",
+			map[string]interface{}{"a": "default", "b": "default"},
+			map[string]interface{}{"a": "user"},
+			map[string]interface{}{"a": "user", "b": "default"},
+		),
+		ginkgo.Entry("nested maps are merged",
+			map[string]interface{}{"a": map[string]interface{}{"b": "default", "c": "default"}},
+			map[string]interface{}{"a": map[string]interface{}{"b": "user"}},
+			map[string]interface{}{"a": map[string]interface{}{"b": "user", "c": "default"}},
+		),
+		ginkgo.Entry("null removes default",
+			map[string]interface{}{"a": "default", "b": "default"},
+			map[string]interface{}{"a": nil},
+			map[string]interface{}{"b": "default"},
+		),
+		ginkgo.Entry("user-supplied keys without defaults are kept",
+			map[string]interface{}{"a": "default"},
+			map[string]interface{}{"b": []interface{}{"user"}},
+			map[string]interface{}{"a": "default", "b": []interface{}{"user"}},
+		),
+	)
+})
+
+var _ = ginkgo.DescribeTable("isSecretDriver",
+	func(helmDriver string, expected bool) {
+		Expect(isSecretDriver(helmDriver)).To(Equal(expected))
+	},
+	ginkgo.Entry("unset", "", true),
+	ginkgo.Entry("secret", "secret", true),
+	ginkgo.Entry("secrets", "secrets", true),
+	ginkgo.Entry("configmap", "configmap", false),
+	ginkgo.Entry("sql", "sql", false),
+	ginkgo.Entry("memory", "memory", false),
+)
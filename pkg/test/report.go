@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	// StatusPassed indicates the check was executed and succeeded
+	StatusPassed Status = "passed"
+	// StatusFailed indicates the check was executed and failed
+	StatusFailed Status = "failed"
+	// StatusSkipped indicates the check was not executed
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the outcome of a single check
+type Result struct {
+	// Name is the name of the check
+	Name string
+	// Status is the outcome of the check
+	Status Status
+	// Start is when the check began executing, or the zero time if it was skipped
+	Start time.Time
+	// Duration is how long the check took to execute
+	Duration time.Duration
+	// Error is the reason the check failed, if it failed
+	Error error
+	// SkipReason is the reason the check was skipped, if it was skipped
+	SkipReason string
+	// URLs are the URLs that were requested by the check
+	URLs []string
+	// Details are additional facts observed by the check, such as certificate expiry times
+	Details map[string]string
+	// Attempts are the outcomes of each time the check was executed, if it was retried according to its RetryPolicy
+	Attempts []Attempt
+	// Responses are the status lines and headers of the HTTP responses the check received, for diagnosing failures
+	Responses []Response
+
+	lock sync.Mutex
+}
+
+func (r *Result) addURL(url string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.URLs = append(r.URLs, url)
+}
+
+func (r *Result) addResponse(response Response) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Responses = append(r.Responses, response)
+}
+
+func (r *Result) setDetail(key, value string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.Details == nil {
+		r.Details = make(map[string]string)
+	}
+	r.Details[key] = value
+}
+
+// Report is the outcome of every check in a test
+type Report struct {
+	// Start is when the test began
+	Start time.Time
+	// Duration is how long the entire test took
+	Duration time.Duration
+	// Results are the outcomes of each check, in the order they were executed
+	Results []*Result
+	// DiagnosticsPath is where the diagnostic bundle was written, if any check failed and Config.DiagnosticsPath was set
+	DiagnosticsPath string
+}
+
+// Passed returns true if no checks failed
+func (r *Report) Passed() bool {
+	return r.Err() == nil
+}
+
+// Err returns the error of the first failed check, or nil if none failed
+func (r *Report) Err() error {
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			return errors.Wrapf(result.Error, "Check %s failed", result.Name)
+		}
+	}
+	return nil
+}
+
+// Count returns the number of checks with a given status
+func (r *Report) Count(status Status) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Response is the status line and headers of an HTTP response received by a check
+type Response struct {
+	// URL is the URL that was requested
+	URL string
+	// Status is the status line, e.g. "502 Bad Gateway"
+	Status string
+	// Header are the response headers
+	Header http.Header
+}
+
+type resultKey struct{}
+
+func withResult(ctx context.Context, result *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, result)
+}
+
+// RecordURL records that a URL was requested as part of the currently executing check.
+// Custom checks should call this so that the URLs they request appear in the report.
+func RecordURL(ctx context.Context, url string) {
+	result, ok := ctx.Value(resultKey{}).(*Result)
+	if !ok {
+		return
+	}
+	result.addURL(url)
+}
+
+// RecordDetail records an additional fact observed by the currently executing check, to be included in the report
+func RecordDetail(ctx context.Context, key, value string) {
+	result, ok := ctx.Value(resultKey{}).(*Result)
+	if !ok {
+		return
+	}
+	result.setDetail(key, value)
+}
+
+// RecordResponse records the status and headers of an HTTP response received by the currently executing check,
+// so that they can be included in the diagnostic bundle if the check fails
+func RecordResponse(ctx context.Context, url string, resp *http.Response) {
+	result, ok := ctx.Value(resultKey{}).(*Result)
+	if !ok || resp == nil {
+		return
+	}
+	result.addResponse(Response{URL: url, Status: resp.Status, Header: resp.Header.Clone()})
+}
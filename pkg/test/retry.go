@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how many times a failing check is executed before it is considered failed
+type RetryPolicy struct {
+	// Attempts is the maximum number of times to execute the check. 0 and 1 both mean the check is not retried.
+	Attempts int
+	// InitialBackoff is how long to wait after the first failed attempt. The wait doubles after each subsequent failed attempt.
+	InitialBackoff time.Duration
+	// MaxElapsed is how long after the first attempt started that no further attempts are started. If 0, only Attempts limits retries.
+	MaxElapsed time.Duration
+}
+
+// ParseRetryPolicy parses a policy in the form attempts[/initialBackoff[/maxElapsed]], e.g. 10/5s/2m.
+// Omitted fields are taken from defaults.
+func ParseRetryPolicy(s string, defaults RetryPolicy) (RetryPolicy, error) {
+	policy := defaults
+	parts := strings.Split(s, "/")
+	if len(parts) > 3 {
+		return policy, fmt.Errorf("Retry policy %s must be in the form attempts[/initialBackoff[/maxElapsed]]", s)
+	}
+	attempts, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return policy, errors.Wrapf(err, "Invalid attempts in retry policy %s", s)
+	}
+	policy.Attempts = attempts
+	if len(parts) > 1 {
+		policy.InitialBackoff, err = time.ParseDuration(parts[1])
+		if err != nil {
+			return policy, errors.Wrapf(err, "Invalid initial backoff in retry policy %s", s)
+		}
+	}
+	if len(parts) > 2 {
+		policy.MaxElapsed, err = time.ParseDuration(parts[2])
+		if err != nil {
+			return policy, errors.Wrapf(err, "Invalid max elapsed time in retry policy %s", s)
+		}
+	}
+	return policy, nil
+}
+
+// Attempt is the outcome of a single execution of a check
+type Attempt struct {
+	// Start is when the attempt began
+	Start time.Time
+	// Duration is how long the attempt took
+	Duration time.Duration
+	// Error is the reason the attempt failed, or nil if it succeeded
+	Error error
+}
+
+// summary describes the outcome of the attempt on a single line
+func (a *Attempt) summary() string {
+	if a.Error != nil {
+		return fmt.Sprintf("failed (%s): %s", a.Duration, a.Error)
+	}
+	return fmt.Sprintf("passed (%s)", a.Duration)
+}
+
+// retryPolicy returns the policy for a check, which is the one in CheckRetry if present, or Retry otherwise
+func (cfg *Config) retryPolicy(name string) RetryPolicy {
+	if policy, ok := cfg.CheckRetry[name]; ok {
+		return policy
+	}
+	return cfg.Retry
+}
+
+// runWithRetry executes a check until it succeeds or its retry policy is exhausted, recording each attempt in the result.
+// Each attempt is cancelled after timeout, if it is non-zero. The objects cached by the Env are fetched again for each retry.
+// The error of the last attempt is returned.
+func runWithRetry(ctx context.Context, check Check, env *Env, policy RetryPolicy, timeout time.Duration, result *Result) error {
+	backoff := policy.InitialBackoff
+	first := time.Now()
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := runWithTimeout(ctx, check, env, timeout)
+		result.Attempts = append(result.Attempts, Attempt{Start: start, Duration: time.Since(start), Error: err})
+		if err == nil || attempt >= policy.Attempts {
+			return err
+		}
+		if policy.MaxElapsed != 0 && time.Since(first)+backoff >= policy.MaxElapsed {
+			return err
+		}
+		log.Printf("Check %s attempt %d/%d failed, retrying in %s: %s", result.Name, attempt, policy.Attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		env.invalidate()
+		backoff *= 2
+	}
+}
+
+// checkTimeout returns the timeout for each attempt of a check, which is the one in CheckTimeouts if present, or CheckTimeout otherwise
+func (cfg *Config) checkTimeout(name string) time.Duration {
+	if timeout, ok := cfg.CheckTimeouts[name]; ok {
+		return timeout
+	}
+	return cfg.CheckTimeout
+}
+
+// runWithTimeout executes a check with a deadline, if timeout is non-zero
+func runWithTimeout(ctx context.Context, check Check, env *Env, timeout time.Duration) error {
+	if timeout == 0 {
+		return check.Run(ctx, env)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := check.Run(attemptCtx, env)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return errors.Wrapf(err, "Timed out after %s", timeout)
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.Describe("runWithRetry", func() {
+	ginkgo.It("should fetch the cached objects again for each retry", func(ctx ginkgo.SpecContext) {
+		env := &Env{statefulSetService: &corev1.Service{}}
+		var cached []bool
+		check := NewCheck("retried", func(ctx context.Context, env *Env) error {
+			cached = append(cached, env.statefulSetService != nil)
+			return errors.New("load balancer has no ingresses")
+		})
+		result := &Result{Name: "retried"}
+		err := runWithRetry(ctx, check, env, RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond}, 0, result)
+		Expect(err).To(HaveOccurred())
+		Expect(cached).To(Equal([]bool{true, false}))
+	})
+
+	// failUntil returns a check which fails until its nth attempt
+	failUntil := func(n int) Check {
+		attempts := 0
+		return NewCheck("retried", func(ctx context.Context, env *Env) error {
+			attempts++
+			if attempts < n {
+				return errors.New("not yet")
+			}
+			return nil
+		})
+	}
+
+	ginkgo.DescribeTable("limiting attempts",
+		func(ctx ginkgo.SpecContext, check Check, policy RetryPolicy, expectedAttempts int, expectErr bool) {
+			result := &Result{Name: "retried"}
+			err := runWithRetry(ctx, check, &Env{}, policy, 0, result)
+			if expectErr {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(result.Attempts).To(HaveLen(expectedAttempts))
+		},
+		ginkgo.Entry("zero policy executes once", failUntil(2), RetryPolicy{}, 1, true),
+		ginkgo.Entry("stops after success", failUntil(2), RetryPolicy{Attempts: 5, InitialBackoff: time.Millisecond}, 2, false),
+		ginkgo.Entry("stops after the last attempt", failUntil(10), RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}, 3, true),
+		// Attempts start at 0 and 50ms, and the next would start at 150ms
+		ginkgo.Entry("stops before the max elapsed time", failUntil(10), RetryPolicy{Attempts: 10, InitialBackoff: 50 * time.Millisecond, MaxElapsed: 120 * time.Millisecond}, 2, true),
+	)
+
+	ginkgo.It("should double the backoff after each failed attempt", func(ctx ginkgo.SpecContext) {
+		result := &Result{Name: "retried"}
+		backoff := 20 * time.Millisecond
+		err := runWithRetry(ctx, failUntil(10), &Env{}, RetryPolicy{Attempts: 4, InitialBackoff: backoff}, 0, result)
+		Expect(err).To(HaveOccurred())
+		Expect(result.Attempts).To(HaveLen(4))
+		for ix := 1; ix < len(result.Attempts); ix++ {
+			Expect(result.Attempts[ix].Start.Sub(result.Attempts[ix-1].Start)).To(BeNumerically(">=", backoff))
+			backoff *= 2
+		}
+	})
+
+	ginkgo.It("should stop waiting to retry when the context is cancelled", func(ctx ginkgo.SpecContext) {
+		cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		result := &Result{Name: "retried"}
+		start := time.Now()
+		err := runWithRetry(cancelCtx, failUntil(10), &Env{}, RetryPolicy{Attempts: 2, InitialBackoff: time.Hour}, 0, result)
+		Expect(err).To(HaveOccurred())
+		Expect(result.Attempts).To(HaveLen(1))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	ginkgo.It("should cancel attempts after the timeout", func(ctx ginkgo.SpecContext) {
+		check := NewCheck("slow", func(ctx context.Context, env *Env) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		result := &Result{Name: "slow"}
+		err := runWithRetry(ctx, check, &Env{}, RetryPolicy{}, 10*time.Millisecond, result)
+		Expect(err).To(MatchError(ContainSubstring("Timed out after 10ms")))
+	})
+})
+
+var _ = ginkgo.DescribeTable("ParseRetryPolicy",
+	func(s string, expected RetryPolicy, expectErr bool) {
+		defaults := RetryPolicy{Attempts: 1, InitialBackoff: time.Second, MaxElapsed: time.Minute}
+		policy, err := ParseRetryPolicy(s, defaults)
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy).To(Equal(expected))
+	},
+	ginkgo.Entry("attempts only", "3", RetryPolicy{Attempts: 3, InitialBackoff: time.Second, MaxElapsed: time.Minute}, false),
+	ginkgo.Entry("attempts and backoff", "3/5s", RetryPolicy{Attempts: 3, InitialBackoff: 5 * time.Second, MaxElapsed: time.Minute}, false),
+	ginkgo.Entry("all fields", "10/5s/2m", RetryPolicy{Attempts: 10, InitialBackoff: 5 * time.Second, MaxElapsed: 2 * time.Minute}, false),
+	ginkgo.Entry("too many fields", "1/1s/1m/1h", RetryPolicy{}, true),
+	ginkgo.Entry("invalid attempts", "many", RetryPolicy{}, true),
+	ginkgo.Entry("invalid backoff", "3/soon", RetryPolicy{}, true),
+	ginkgo.Entry("invalid max elapsed", "3/5s/later", RetryPolicy{}, true),
+)
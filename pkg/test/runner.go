@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// skipReason returns why a check should not be started, or an empty string if it should be.
+// Every dependency of the check must have already finished.
+func skipReason(cfg *Config, check Check, results map[string]*Result, notReady bool, firstFailure string) string {
+	if notReady {
+		return "Release was not ready"
+	}
+	if firstFailure != "" && !cfg.ContinueOnFailure {
+		return fmt.Sprintf("Check %s failed", firstFailure)
+	}
+	if reason := cfg.checkSkipReason(check.Name()); reason != "" {
+		return reason
+	}
+	for _, dep := range check.Dependencies() {
+		if results[dep].Status != StatusPassed {
+			return fmt.Sprintf("Dependency %s %s", dep, results[dep].Status)
+		}
+	}
+	return ""
+}
+
+// runCheck executes a single check, recording its outcome in result
+func runCheck(ctx context.Context, env *Env, check Check, result *Result) {
+	cfg := env.Config
+	result.Start = time.Now()
+	err := runWithRetry(withResult(ctx, result), check, env, cfg.retryPolicy(result.Name), cfg.checkTimeout(result.Name), result)
+	result.Duration = time.Since(result.Start)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err
+		log.Printf("Check %s failed: %s", result.Name, err)
+		return
+	}
+	result.Status = StatusPassed
+}
+
+// runChecks executes checks, which must be in dependency order, with up to Parallelism at once.
+// Whenever a check can be started, the first one in order whose dependencies have all finished is started,
+// so with a Parallelism of 1, checks are executed strictly in order.
+// The results are returned in the same order as the checks.
+func runChecks(ctx context.Context, env *Env, checks []Check, notReady bool) []*Result {
+	cfg := env.Config
+	parallelism := cfg.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results := make([]*Result, len(checks))
+	byName := make(map[string]*Result, len(checks))
+	for ix, check := range checks {
+		results[ix] = &Result{Name: check.Name()}
+		byName[check.Name()] = results[ix]
+	}
+
+	finished := make(map[string]bool, len(checks))
+	ready := func(check Check) bool {
+		for _, dep := range check.Dependencies() {
+			if !finished[dep] {
+				return false
+			}
+		}
+		return true
+	}
+
+	pending := make([]int, len(checks))
+	for ix := range checks {
+		pending[ix] = ix
+	}
+	done := make(chan int)
+	running := 0
+	var firstFailure string
+	for len(pending) != 0 || running != 0 {
+		for i := 0; i < len(pending) && running < parallelism; {
+			ix := pending[i]
+			check := checks[ix]
+			if !ready(check) {
+				i++
+				continue
+			}
+			pending = append(pending[:i], pending[i+1:]...)
+			result := results[ix]
+			if reason := skipReason(cfg, check, byName, notReady, firstFailure); reason != "" {
+				result.Status = StatusSkipped
+				result.SkipReason = reason
+				log.Printf("Skipping %s: %s", result.Name, result.SkipReason)
+				finished[result.Name] = true
+				// Skipping a check may make an earlier pending check ready
+				i = 0
+				continue
+			}
+			running++
+			go func() {
+				runCheck(ctx, env, check, result)
+				done <- ix
+			}()
+		}
+		if running == 0 {
+			// Unreachable if the checks are in dependency order
+			break
+		}
+		ix := <-done
+		running--
+		result := results[ix]
+		finished[result.Name] = true
+		if result.Status == StatusFailed && firstFailure == "" {
+			firstFailure = result.Name
+		}
+	}
+	return results
+}
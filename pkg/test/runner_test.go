@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fail is the body of a check that always fails
+func fail(ctx context.Context, env *Env) error {
+	return errors.New("failed")
+}
+
+// resultStatuses returns the status of each result, keyed by check name
+func resultStatuses(results []*Result) map[string]Status {
+	statuses := make(map[string]Status, len(results))
+	for _, result := range results {
+		statuses[result.Name] = result.Status
+	}
+	return statuses
+}
+
+var _ = ginkgo.Describe("runChecks", func() {
+	ginkgo.DescribeTable("skipping checks",
+		func(cfg *Config, notReady bool, checks []Check, expected map[string]Status) {
+			results := runChecks(context.Background(), &Env{Config: cfg}, checks, notReady)
+			Expect(checkNames(checks)).To(Equal(resultNames(results)))
+			Expect(resultStatuses(results)).To(Equal(expected))
+		},
+		ginkgo.Entry("dependents of a failed check, but not independent checks, when continuing on failure",
+			&Config{ContinueOnFailure: true},
+			false,
+			[]Check{NewCheck("a", fail), NewCheck("b", noop, "a"), NewCheck("c", noop, "b"), NewCheck("d", noop)},
+			map[string]Status{"a": StatusFailed, "b": StatusSkipped, "c": StatusSkipped, "d": StatusPassed},
+		),
+		ginkgo.Entry("every check after a failure otherwise",
+			&Config{},
+			false,
+			[]Check{NewCheck("a", noop), NewCheck("b", fail), NewCheck("c", noop)},
+			map[string]Status{"a": StatusPassed, "b": StatusFailed, "c": StatusSkipped},
+		),
+		ginkgo.Entry("dependents of a skipped check",
+			&Config{Skip: []string{"a"}},
+			false,
+			[]Check{NewCheck("a", noop), NewCheck("b", noop, "a"), NewCheck("c", noop)},
+			map[string]Status{"a": StatusSkipped, "b": StatusSkipped, "c": StatusPassed},
+		),
+		ginkgo.Entry("every check if the release was not ready",
+			&Config{},
+			true,
+			[]Check{NewCheck("a", noop), NewCheck("b", noop)},
+			map[string]Status{"a": StatusSkipped, "b": StatusSkipped},
+		),
+	)
+
+	ginkgo.It("should record why dependents were skipped", func() {
+		checks := []Check{NewCheck("a", fail), NewCheck("b", noop, "a")}
+		results := runChecks(context.Background(), &Env{Config: &Config{ContinueOnFailure: true}}, checks, false)
+		Expect(results[1].SkipReason).To(Equal("Dependency a failed"))
+	})
+
+	ginkgo.It("should execute independent checks at once, up to the parallelism", func(ctx ginkgo.SpecContext) {
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		check := func(ctx context.Context, env *Env) error {
+			lock.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			return nil
+		}
+		checks := []Check{NewCheck("a", check), NewCheck("b", check), NewCheck("c", check), NewCheck("d", check)}
+		results := runChecks(ctx, &Env{Config: &Config{Parallelism: 2}}, checks, false)
+		Expect(resultStatuses(results)).To(HaveEach(StatusPassed))
+		Expect(maxRunning).To(Equal(2))
+	})
+
+	ginkgo.It("should not start a check until its dependencies have finished", func(ctx ginkgo.SpecContext) {
+		var lock sync.Mutex
+		var order []string
+		record := func(name string, delay time.Duration) func(context.Context, *Env) error {
+			return func(ctx context.Context, env *Env) error {
+				time.Sleep(delay)
+				lock.Lock()
+				defer lock.Unlock()
+				order = append(order, name)
+				return nil
+			}
+		}
+		checks := []Check{
+			NewCheck("slow", record("slow", 50*time.Millisecond)),
+			NewCheck("dependent", record("dependent", 0), "slow"),
+			NewCheck("fast", record("fast", 0)),
+		}
+		results := runChecks(ctx, &Env{Config: &Config{Parallelism: 3}}, checks, false)
+		Expect(resultStatuses(results)).To(HaveEach(StatusPassed))
+		Expect(order).To(Equal([]string{"fast", "slow", "dependent"}))
+	})
+
+	ginkgo.It("should execute checks strictly in order with a parallelism of 1", func(ctx ginkgo.SpecContext) {
+		var order []string
+		record := func(name string) func(context.Context, *Env) error {
+			return func(ctx context.Context, env *Env) error {
+				order = append(order, name)
+				return nil
+			}
+		}
+		checks := []Check{NewCheck("a", record("a")), NewCheck("b", record("b")), NewCheck("c", record("c"))}
+		runChecks(ctx, &Env{Config: &Config{}}, checks, false)
+		Expect(order).To(Equal([]string{"a", "b", "c"}))
+	})
+})
+
+// resultNames returns the names of results, in order
+func resultNames(results []*Result) []string {
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	return names
+}
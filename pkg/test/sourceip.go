@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodePortRefuseTimeout is how long to wait for a response from a NodePort on a node without endpoints before concluding that it refused the traffic.
+// kube-proxy drops such traffic instead of rejecting it, so a timeout is expected.
+const nodePortRefuseTimeout = 5 * time.Second
+
+// expectedSourceIP returns the IP the pods should observe as the client IP when the source IP is preserved.
+// This is SourceIP if set, otherwise the local IP the tester would use to connect to address, which is only correct if nothing between the tester and the cluster does NAT.
+func (cfg *Config) expectedSourceIP(address string) (string, error) {
+	if cfg.SourceIP != "" {
+		return cfg.SourceIP, nil
+	}
+	// Dialing UDP sends no packets, but chooses the local address from the routing table
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to determine the local IP used to reach %s, set the source IP explicitly", address)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// nodeAddressType returns the type of node address to connect to NodePorts on, which is NodeAddressType if set, or InternalIP otherwise
+func (cfg *Config) nodeAddressType() corev1.NodeAddressType {
+	if cfg.NodeAddressType != "" {
+		return cfg.NodeAddressType
+	}
+	return corev1.NodeInternalIP
+}
+
+// TestLoadBalancerSourceIP sends a request to the /echo endpoint of the StatefulSet through each ingress of its LoadBalancer,
+// and checks that the client IP observed by the pod is the tester's source IP
+func TestLoadBalancerSourceIP(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
+	addresses, err := loadBalancerAddresses(statefulSetService)
+	if err != nil {
+		return err
+	}
+	for ix, address := range addresses {
+		expected, err := cfg.expectedSourceIP(address)
+		if err != nil {
+			return err
+		}
+		resp, err := getEchoURL(ctx, cfg.HTTP, "http://"+address)
+		if err != nil {
+			return errors.Wrapf(err, "LoadBalancer ingress index %d failed", ix)
+		}
+		RecordDetail(ctx, fmt.Sprintf("ingress %d clientIP", ix), resp.ClientIP)
+		RecordDetail(ctx, fmt.Sprintf("ingress %d expectedClientIP", ix), expected)
+		if resp.ClientIP != expected {
+			return fmt.Errorf("LoadBalancer ingress index %d did not preserve the source IP: pod %s observed client IP %s instead of %s", ix, resp.Pod.Name, resp.ClientIP, expected)
+		}
+	}
+	return nil
+}
+
+// isRefusal returns true if a request failed because the connection could not be made, was reset, or received no response before reqCtx expired,
+// rather than because of the response it received
+func isRefusal(reqCtx context.Context, err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(reqCtx.Err(), context.DeadlineExceeded)
+}
+
+// expectRefused requests the /echo endpoint of a base URL which should not serve any traffic, and returns an error unless it was refused, reset, or timed out.
+// Any HTTP response, even an error status, means the traffic was served. A description of the outcome is returned in either case.
+func expectRefused(ctx context.Context, cfg *Config, baseURL string, timeout time.Duration) (string, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := getEchoURL(reqCtx, cfg.HTTP, baseURL)
+	if err == nil {
+		return fmt.Sprintf("served by %s, client IP %s", resp.Pod.Name, resp.ClientIP), fmt.Errorf("was served by pod %s", resp.Pod.Name)
+	}
+	if isRefusal(reqCtx, err) {
+		return fmt.Sprintf("refused: %s", err), nil
+	}
+	return fmt.Sprintf("served: %s", err), fmt.Errorf("accepted the connection: %s", err)
+}
+
+// TestNodePortLocal connects to the NodePort of the StatefulSet Service on every node.
+// The node running the StatefulSet pod must serve the request and preserve the source IP, and every other node must refuse it.
+// The outcome for each node is recorded as a detail of the result, and the error lists every node which behaved incorrectly.
+func TestNodePortLocal(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, statefulSetService *corev1.Service, fullname string) error {
+	nodePort, err := statefulSetNodePort(statefulSetService)
+	if err != nil {
+		return err
+	}
+	podName := fullname + "-0"
+	pod, err := k8sClient.CoreV1().Pods(cfg.ReleaseNamespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get StatefulSet pod %s", podName)
+	}
+	nodes, err := k8sClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "Failed to list nodes")
+	}
+	addressType := cfg.nodeAddressType()
+
+	var failures []string
+	for _, node := range nodes.Items {
+		address := ""
+		for _, nodeAddress := range node.Status.Addresses {
+			if nodeAddress.Type == addressType {
+				address = nodeAddress.Address
+				break
+			}
+		}
+		if address == "" {
+			failures = append(failures, fmt.Sprintf("node %s has no %s address", node.Name, addressType))
+			continue
+		}
+		hostPort := net.JoinHostPort(address, strconv.Itoa(int(nodePort)))
+		if node.Name == pod.Spec.NodeName {
+			resp, err := getEchoURL(ctx, cfg.HTTP, "http://"+hostPort)
+			if err != nil {
+				RecordDetail(ctx, node.Name, fmt.Sprintf("failed: %s", err))
+				failures = append(failures, fmt.Sprintf("node %s has the endpoint but failed: %s", node.Name, err))
+				continue
+			}
+			RecordDetail(ctx, node.Name, fmt.Sprintf("served by %s, client IP %s", resp.Pod.Name, resp.ClientIP))
+			expected, err := cfg.expectedSourceIP(hostPort)
+			if err != nil {
+				return err
+			}
+			if resp.ClientIP != expected {
+				failures = append(failures, fmt.Sprintf("node %s did not preserve the source IP: pod observed client IP %s instead of %s", node.Name, resp.ClientIP, expected))
+			}
+			continue
+		}
+		detail, err := expectRefused(ctx, cfg, "http://"+hostPort, nodePortRefuseTimeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		RecordDetail(ctx, node.Name, detail)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("node %s has no endpoints but %s", node.Name, err))
+		}
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("NodePort %d with externalTrafficPolicy Local misbehaved on %d of %d nodes: %s", nodePort, len(failures), len(nodes.Items), strings.Join(failures, "; "))
+	}
+	return nil
+}
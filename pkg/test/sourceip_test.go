@@ -0,0 +1,68 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = ginkgo.Describe("expectRefused", func() {
+	serve := func(handler http.HandlerFunc) string {
+		srv := httptest.NewServer(handler)
+		ginkgo.DeferCleanup(srv.Close)
+		return srv.URL
+	}
+
+	ginkgo.DescribeTable("treating any HTTP response as served",
+		func(ctx ginkgo.SpecContext, handler http.HandlerFunc) {
+			url := serve(handler)
+			_, err := expectRefused(ctx, &Config{HTTP: &http.Client{}}, url, time.Second)
+			Expect(err).To(HaveOccurred())
+		},
+		ginkgo.Entry("echo response", serveEchoHandler("statefulset-0")),
+		ginkgo.Entry("404", http.HandlerFunc(http.NotFound)),
+		ginkgo.Entry("500", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		})),
+	)
+
+	ginkgo.It("should treat a refused connection as refused", func(ctx ginkgo.SpecContext) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		address := listener.Addr().String()
+		Expect(listener.Close()).To(Succeed())
+		detail, err := expectRefused(ctx, &Config{HTTP: &http.Client{}}, "http://"+address, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(detail).To(HavePrefix("refused: "))
+	})
+
+	ginkgo.It("should treat no response before the timeout as refused", func(ctx ginkgo.SpecContext) {
+		url := serve(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		detail, err := expectRefused(ctx, &Config{HTTP: &http.Client{}}, url, 50*time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(detail).To(HavePrefix("refused: "))
+	})
+})
+
+var _ = ginkgo.DescribeTable("statefulSetNodePort",
+	func(ports []corev1.ServicePort, expected int32, expectErr bool) {
+		nodePort, err := statefulSetNodePort(&corev1.Service{Spec: corev1.ServiceSpec{Ports: ports}})
+		if expectErr {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nodePort).To(Equal(expected))
+	},
+	ginkgo.Entry("no ports", nil, int32(0), true),
+	ginkgo.Entry("no nodePort", []corev1.ServicePort{{Port: 80}}, int32(0), true),
+	ginkgo.Entry("nodePort", []corev1.ServicePort{{Port: 80, NodePort: 30080}}, int32(30080), false),
+)
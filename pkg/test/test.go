@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -23,10 +26,13 @@ import (
 	"k8s.io/client-go/transport/spdy"
 )
 
-func testURL(errName string, url string, resp *http.Response, err error, expectedRespBody string) error {
+func testURL(ctx context.Context, errName string, url string, resp *http.Response, err error, expectedRespBody string) error {
+	RecordURL(ctx, url)
 	if err != nil {
 		return fmt.Errorf("Failed to connect to %s %s: %s", errName, url, err)
 	}
+	defer resp.Body.Close()
+	RecordResponse(ctx, url, resp)
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("Failed to ready body from %s %s: %s", errName, url, err)
@@ -49,6 +55,20 @@ type MergedValues struct {
 	TestFile         TestFile          `json:"testFile"`
 	Deployment       DeploymentValues  `json:"deployment"`
 	StatefulSet      StatefulSetValues `json:"statefulset"`
+	DaemonSet        DaemonSetValues   `json:"daemonset"`
+	Persistence      PersistenceValues `json:"persistence"`
+	DNS              DNSValues         `json:"dns"`
+}
+
+// isEnabled interprets an optional enabled: field, which defaults to true if absent
+func isEnabled(enabled *bool) bool {
+	return enabled == nil || *enabled
+}
+
+// DaemonSetValues is the subset of the helm values.yaml daemonset: field that need to be inspected to execute the test
+type DaemonSetValues struct {
+	// Enabled defaults to false, unlike the other enabled: fields
+	Enabled bool `json:"enabled"`
 }
 
 // TestFile is the location and contents of a test file to submit to the services as part of the test
@@ -64,20 +84,55 @@ type DeploymentValues struct {
 
 // DeploymentValues is the subset of the helm values.yaml deployment.ingress: field that need to be inspected to execute the test
 type DeploymentIngressValues struct {
+	Enabled  *bool                        `json:"enabled"`
 	Hostname string                       `json:"hostname"`
 	TLS      []DeploymentIngressTLSValues `json:"tls"`
 }
 
 // DeploymentValues is the subset of the helm values.yaml deployment.ingress.tls: field that need to be inspected to execute the test
 type DeploymentIngressTLSValues struct {
+	SecretName string   `json:"secretName"`
+	Hosts      []string `json:"hosts"`
 }
 
 // DeploymentValues is the subset of the helm values.yaml statefulset: field that need to be inspected to execute the test
 type StatefulSetValues struct {
-	NodePortHostname string `json:"nodePortHostname"`
+	NodePortHostname string                   `json:"nodePortHostname"`
+	Service          StatefulSetServiceValues `json:"service"`
+}
+
+// StatefulSetServiceValues is the subset of the helm values.yaml statefulset.service: field that need to be inspected to execute the test
+type StatefulSetServiceValues struct {
+	Type                  corev1.ServiceType                  `json:"type"`
+	ExternalTrafficPolicy corev1.ServiceExternalTrafficPolicy `json:"externalTrafficPolicy"`
+}
+
+// PersistenceValues is the subset of the helm values.yaml persistence: field that need to be inspected to execute the test
+type PersistenceValues struct {
+	RWO PersistenceVolumeValues `json:"rwo"`
+	RWX PersistenceVolumeValues `json:"rwx"`
 }
 
-func portForward(ctx context.Context, k8sConfig *rest.Config, namespace, pod string, ports []string, f func() error) error {
+// PersistenceVolumeValues is the subset of the helm values.yaml persistence.rwo: and persistence.rwx: fields that need to be inspected to execute the test
+type PersistenceVolumeValues struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// DNSValues is the subset of the helm values.yaml dns: field that need to be inspected to execute the test
+type DNSValues struct {
+	ClusterDomain string                `json:"clusterDomain"`
+	ExternalName  DNSExternalNameValues `json:"externalName"`
+}
+
+// DNSExternalNameValues is the subset of the helm values.yaml dns.externalName: field that need to be inspected to execute the test
+type DNSExternalNameValues struct {
+	Enabled *bool  `json:"enabled"`
+	Target  string `json:"target"`
+}
+
+// portForward forwards ports to a pod for the duration of a function, which is passed the local ports that were bound, in the same order as ports.
+// Local ports of 0 are bound to a free port chosen by the OS.
+func portForward(ctx context.Context, k8sConfig *rest.Config, namespace, pod string, ports []string, f func(localPorts []uint16) error) error {
 	portForwardURL, err := url.Parse(k8sConfig.Host)
 	if err != nil {
 		return errors.Wrap(err, "Failed to parse Kubernetes server URL")
@@ -95,8 +150,9 @@ func portForward(ctx context.Context, k8sConfig *rest.Config, namespace, pod str
 	ready := make(chan struct{})
 	stop := make(chan struct{})
 	defer close(stop)
-	errChan := make(chan error)
-	forwarder, err := portforward.New(dialer, ports, stop, ready, os.Stdout, os.Stderr)
+	errChan := make(chan error, 1)
+	// Standard output is reserved for the report
+	forwarder, err := portforward.New(dialer, ports, stop, ready, os.Stderr, os.Stderr)
 	if err != nil {
 		return err
 	}
@@ -108,10 +164,18 @@ func portForward(ctx context.Context, k8sConfig *rest.Config, namespace, pod str
 	case err = <-errChan:
 		return err
 	case <-ctx.Done():
-		return context.Canceled
+		return ctx.Err()
 	case <-ready:
 	}
-	return f()
+	forwardedPorts, err := forwarder.GetPorts()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get forwarded ports")
+	}
+	localPorts := make([]uint16, 0, len(forwardedPorts))
+	for _, port := range forwardedPorts {
+		localPorts = append(localPorts, port.Local)
+	}
+	return f(localPorts)
 }
 
 // Config is the configuration for a test
@@ -126,14 +190,70 @@ type Config struct {
 	ReleaseName string
 	// MergedValues is the parsed complete values.yaml from the helm release
 	MergedValues *MergedValues
-	// PortForwardLocalPort is the local port to use to test port-forwarding
+	// PortForwardLocalPort is the local port to use to test port-forwarding.
+	// If 0, a free port is chosen, which allows multiple tests to run on the same machine at once.
 	PortForwardLocalPort int
+	// PortForwardAllReplicas indicates to test port-forwarding to every pod of the Deployment in turn, instead of just one
+	PortForwardAllReplicas bool
+	// PerNode indicates to run the port-forward and logs checks against one pod of the Deployment on each node it is scheduled to.
+	// Set deployment.spreadAcrossNodes and deployment.replicaCount in the chart to cover every node.
+	PerNode bool
 	// IngressHostname is the hostname to use instead of the ingress hostname from the values.yaml to contact the services over ingress.
 	// If non-empty, requests to the ingress will use this as the hostname in the URL, and the deployment.ingress.hostname as the Host header/TLS server name.
 	// This can be used to test ingress when DNS is not configured.
 	IngressHostname string
 	// IngressTLS indicates to use TLS (HTTPS) for testing the ingress, regardless of what is set in the helm values.yaml
 	IngressTLS bool
+	// IngressAddress is the IP or hostname, with an optional port, to connect to when contacting the services over ingress.
+	// If non-empty, the URL, Host header and TLS server name are unchanged, but the connection is made to this address instead of what the hostname resolves to.
+	// This can be used to test an ingress controller behind a VIP when DNS is not configured. It has no effect if the HTTP client uses a proxy.
+	IngressAddress string
+	// IngressTLSCompareSecret indicates that the certificate served by the ingress must be the one in the secret referenced by deployment.ingress.tls,
+	// and not just any certificate that is valid for the hostname
+	IngressTLSCompareSecret bool
+	// IngressRequireForwardedHeaders indicates that the ingress-echo check fails if the ingress controller does not set X-Forwarded-For or Forwarded
+	IngressRequireForwardedHeaders bool
+	// SourceIP is the IP the pods should observe as the client IP in the loadbalancer-source-ip and nodeport-local checks.
+	// If empty, the local IP used to connect to the cluster is expected, which is only correct if there is no NAT between the tester and the cluster.
+	SourceIP string
+	// NodeAddressType is the type of node address to connect to in the nodeport-local check. If empty, InternalIP is used.
+	NodeAddressType corev1.NodeAddressType
+	// WaitTimeout is how long to wait for the resources of the release to be ready before executing any checks.
+	// If 0, checks are executed immediately. If the release is not ready in time, every check is skipped.
+	WaitTimeout time.Duration
+	// Retry is the retry policy for checks which are not in CheckRetry. The zero value executes each check once.
+	Retry RetryPolicy
+	// CheckRetry overrides the retry policy for individual checks, by name
+	CheckRetry map[string]RetryPolicy
+	// CheckTimeout is how long each attempt of a check may take before it is cancelled and fails. If 0, attempts are not limited.
+	CheckTimeout time.Duration
+	// CheckTimeouts overrides CheckTimeout for individual checks, by name
+	CheckTimeouts map[string]time.Duration
+	// LogsMaxBytes is the maximum number of bytes of each pod's logs to read in the logs check. If 0, all logs are read.
+	LogsMaxBytes int64
+	// LogsMaxDuration is how long to read each pod's logs for in the logs check before stopping. If 0, reading is only limited by the check timeout.
+	// Reaching either limit does not fail the check.
+	LogsMaxDuration time.Duration
+	// Registry contains the checks to execute. If nil, DefaultRegistry is used.
+	Registry *Registry
+	// Only is the names of the checks to execute. If empty, all checks are executed, except for those in Skip.
+	Only []string
+	// Skip is the names of checks to not execute. Skipped checks are reported as skipped, not passed.
+	Skip []string
+	// Parallelism is the maximum number of checks to execute at once. If 0 or 1, checks are executed one at a time.
+	// Results are reported in the same order regardless.
+	Parallelism int
+	// ContinueOnFailure indicates to continue executing checks after one fails.
+	// Checks which depend on a failed check are still skipped.
+	ContinueOnFailure bool
+	// Events is whether to watch for warning events involving the Pods, PVCs, Services and Ingress of the release while the checks execute,
+	// and whether to fail or just warn if any have a reason in EventReasons. Events during the wait for the release to be ready are ignored.
+	Events EventsMode
+	// EventReasons are the reasons of warning events to fail or warn on. If empty, DefaultEventReasons is used.
+	EventReasons []string
+	// DiagnosticsPath is the path to write a tarball of diagnostic information to if any check fails. See CollectDiagnostics.
+	// If empty, no diagnostics are collected.
+	DiagnosticsPath string
 }
 
 func (cfg *Config) K8sClient() (*kubernetes.Clientset, error) {
@@ -151,7 +271,8 @@ func (cfg *Config) Fullname() string {
 	return cfg.ReleaseName + "-k8s-smoke-test"
 }
 
-func (cfg *Config) PickDeploymentPod(ctx context.Context, k8sClient *kubernetes.Clientset, fullname string) (*corev1.Pod, error) {
+// ListDeploymentPods lists the pods of the Deployment which are Running, Ready, and not being deleted
+func (cfg *Config) ListDeploymentPods(ctx context.Context, k8sClient *kubernetes.Clientset, fullname string) ([]corev1.Pod, error) {
 	deploymentService, err := k8sClient.CoreV1().Services(cfg.ReleaseNamespace).Get(ctx, fmt.Sprintf("%s-deployment", fullname), metav1.GetOptions{})
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to get Deployment Service")
@@ -165,7 +286,20 @@ func (cfg *Config) PickDeploymentPod(ctx context.Context, k8sClient *kubernetes.
 	if len(deploymentPods.Items) == 0 {
 		return nil, errors.New("No deployment pods were present")
 	}
-	return &deploymentPods.Items[0], nil
+	ready := readyPods(deploymentPods.Items)
+	if len(ready) == 0 {
+		return nil, fmt.Errorf("None of the %d deployment pods are Running and Ready", len(deploymentPods.Items))
+	}
+	return ready, nil
+}
+
+// PickDeploymentPod picks a pod of the Deployment which is Running, Ready, and not being deleted
+func (cfg *Config) PickDeploymentPod(ctx context.Context, k8sClient *kubernetes.Clientset, fullname string) (*corev1.Pod, error) {
+	deploymentPods, err := cfg.ListDeploymentPods(ctx, k8sClient, fullname)
+	if err != nil {
+		return nil, err
+	}
+	return &deploymentPods[0], nil
 }
 
 func (cfg *Config) GetStatefulSetService(ctx context.Context, k8sClient *kubernetes.Clientset, fullname string) (*corev1.Service, error) {
@@ -176,67 +310,152 @@ func (cfg *Config) GetStatefulSetService(ctx context.Context, k8sClient *kuberne
 	return statefulSetService, nil
 }
 
+// checkSkipReason returns the reason a check should not be executed, or an empty string if it should
+func (cfg *Config) checkSkipReason(name string) string {
+	if len(cfg.Only) != 0 && !containsString(cfg.Only, name) {
+		return "Not in the list of checks to run"
+	}
+	if containsString(cfg.Skip, name) {
+		return "In the list of checks to skip"
+	}
+	values := cfg.MergedValues
+	switch name {
+	case CheckIngress:
+		if !isEnabled(values.Deployment.Ingress.Enabled) {
+			return "Ingress is disabled by deployment.ingress.enabled"
+		}
+	case CheckIngressTLS:
+		if !cfg.ingressUsesTLS() {
+			return "Ingress does not use TLS"
+		}
+	case CheckNodePort:
+		if values.StatefulSet.Service.Type == corev1.ServiceTypeClusterIP {
+			return "StatefulSet Service is not a NodePort or LoadBalancer by statefulset.service.type"
+		}
+	case CheckLoadBalancer:
+		if values.StatefulSet.Service.Type != "" && values.StatefulSet.Service.Type != corev1.ServiceTypeLoadBalancer {
+			return "StatefulSet Service is not a LoadBalancer by statefulset.service.type"
+		}
+	case CheckLoadBalancerSourceIP, CheckNodePortLocal:
+		if values.StatefulSet.Service.ExternalTrafficPolicy != corev1.ServiceExternalTrafficPolicyLocal {
+			return "StatefulSet Service does not use externalTrafficPolicy Local by statefulset.service.externalTrafficPolicy"
+		}
+	case CheckConnectivityMatrix:
+		if !values.DaemonSet.Enabled {
+			return "DaemonSet is disabled by daemonset.enabled"
+		}
+	case CheckRWO:
+		if !isEnabled(values.Persistence.RWO.Enabled) {
+			return "RWO persistence is disabled by persistence.rwo.enabled"
+		}
+	case CheckRWX:
+		if !isEnabled(values.Persistence.RWX.Enabled) {
+			return "RWX persistence is disabled by persistence.rwx.enabled"
+		}
+	}
+	return ""
+}
+
+// testFilePath returns the path to GET to test connectivity, and the expected response body.
+// This is the file written by the Job to the RWX volume, unless the RWX check is skipped,
+// in which case the health check is used instead.
+func (cfg *Config) testFilePath() (path string, expectedBody string) {
+	if cfg.checkSkipReason(CheckRWX) != "" {
+		return "/health", ""
+	}
+	return "/rwx/" + cfg.MergedValues.TestFile.Name, cfg.MergedValues.TestFile.Contents
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// TestPortForward tests port-forwarding to a pod, and checks that the pod itself served the request
 func TestPortForward(ctx context.Context, cfg *Config, pod *corev1.Pod) error {
-	return portForward(ctx, cfg.K8sConfig, cfg.ReleaseNamespace, pod.Name, []string{fmt.Sprintf("%d:8080", cfg.PortForwardLocalPort)}, func() error {
-		portForwardURL := fmt.Sprintf("http://localhost:%d/rwx/%s", cfg.PortForwardLocalPort, cfg.MergedValues.TestFile.Name)
-		resp, err := cfg.HTTP.Get(portForwardURL)
-		err = testURL("GET RWO Port-Forward", portForwardURL, resp, err, cfg.MergedValues.TestFile.Contents)
+	return withPortForward(ctx, cfg, pod.Name, serverPort, func(baseURL string) error {
+		err := getTestFile(ctx, cfg, "GET Port-Forward", baseURL)
 		if err != nil {
 			return err
 		}
-		return nil
+		return expectServedBy(ctx, cfg, baseURL, pod.Name)
 	})
 }
 
-func TestIngress(ctx context.Context, cfg *Config) error {
-	ingressHostname := cfg.IngressHostname
-	if ingressHostname == "" {
-		ingressHostname = cfg.MergedValues.Deployment.Ingress.Hostname
-	}
+// ingressRequest creates a GET request for a path on the ingress, to be sent with the client from Env.IngressClient
+func (cfg *Config) ingressRequest(ctx context.Context, path string) (*http.Request, error) {
 	ingressProtocol := "http"
-	if cfg.IngressTLS || len(cfg.MergedValues.Deployment.Ingress.TLS) != 0 {
+	if cfg.ingressUsesTLS() {
 		ingressProtocol = "https"
 	}
-	ingressURL := fmt.Sprintf("%s://%s/rwx/%s", ingressProtocol, ingressHostname, cfg.MergedValues.TestFile.Name)
-	req, err := http.NewRequest(http.MethodGet, ingressURL, nil)
+	ingressURL := fmt.Sprintf("%s://%s%s", ingressProtocol, cfg.ingressURLHost(), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ingressURL, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if cfg.IngressHostname != "" {
 		req.Host = cfg.MergedValues.Deployment.Ingress.Hostname
 	}
-	resp, err := cfg.HTTP.Do(req)
-	err = testURL("GET RWO Ingress", ingressURL, resp, err, cfg.MergedValues.TestFile.Contents)
+	return req, nil
+}
+
+func TestIngress(ctx context.Context, cfg *Config, client *http.Client) error {
+	path, expectedBody := cfg.testFilePath()
+	req, err := cfg.ingressRequest(ctx, path)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	err = testURL(ctx, "GET Ingress", req.URL.String(), resp, err, expectedBody)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func TestNodePort(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
-	nodePortHostname := cfg.MergedValues.StatefulSet.NodePortHostname
+// statefulSetNodePort returns the NodePort of the first port of the StatefulSet Service
+func statefulSetNodePort(statefulSetService *corev1.Service) (int32, error) {
+	if len(statefulSetService.Spec.Ports) == 0 {
+		return 0, fmt.Errorf("StatefulSet service %s has no ports", statefulSetService.Name)
+	}
 	nodePort := statefulSetService.Spec.Ports[0].NodePort
 	if nodePort == 0 {
-		return fmt.Errorf("LoadBalancer service does not have a nodePort assigned")
+		return 0, fmt.Errorf("StatefulSet service does not have a nodePort assigned")
 	}
+	return nodePort, nil
+}
 
-	nodePortURL := fmt.Sprintf("http://%s:%d/rwx/%s", nodePortHostname, nodePort, cfg.MergedValues.TestFile.Name)
-	resp, err := cfg.HTTP.Get(nodePortURL)
-	err = testURL("GET RWX NodePort", nodePortURL, resp, err, cfg.MergedValues.TestFile.Contents)
+func TestNodePort(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
+	nodePortHostname := cfg.MergedValues.StatefulSet.NodePortHostname
+	nodePort, err := statefulSetNodePort(statefulSetService)
+	if err != nil {
+		return err
+	}
+
+	path, expectedBody := cfg.testFilePath()
+	nodePortURL := fmt.Sprintf("http://%s:%d%s", nodePortHostname, nodePort, path)
+	resp, err := httpGet(ctx, cfg.HTTP, nodePortURL)
+	err = testURL(ctx, "GET NodePort", nodePortURL, resp, err, expectedBody)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func TestLoadBalancer(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
+// loadBalancerAddresses returns the host:port addresses of each ingress of a LoadBalancer Service
+func loadBalancerAddresses(statefulSetService *corev1.Service) ([]string, error) {
 	statefulSetServiceIngresses := statefulSetService.Status.LoadBalancer.Ingress
 	if len(statefulSetServiceIngresses) == 0 {
-		return fmt.Errorf("LoadBalancer service has no ingresses")
+		return nil, fmt.Errorf("LoadBalancer service has no ingresses")
 	}
+	addresses := make([]string, 0, len(statefulSetServiceIngresses))
 	for ix, ingress := range statefulSetServiceIngresses {
 		if ingress.Hostname == "" && ingress.IP == "" {
-			return fmt.Errorf("LoadBalancer servce ingress at index %d has neither a Hostname nor an IP", ix)
+			return nil, fmt.Errorf("LoadBalancer servce ingress at index %d has neither a Hostname nor an IP", ix)
 		}
 		hostname := ingress.Hostname
 		if hostname == "" {
@@ -244,34 +463,54 @@ func TestLoadBalancer(ctx context.Context, cfg *Config, statefulSetService *core
 		}
 
 		if len(ingress.Ports) != len(statefulSetService.Spec.Ports) {
-			return fmt.Errorf("LoadBalancer service ingress at index %d has %d ports instead of the expected %d", ix, len(ingress.Ports), len(statefulSetService.Spec.Ports))
+			return nil, fmt.Errorf("LoadBalancer service ingress at index %d has %d ports instead of the expected %d", ix, len(ingress.Ports), len(statefulSetService.Spec.Ports))
 		}
 		ingressPortStatus := ingress.Ports[0]
 		if ingressPortStatus.Error != nil {
-			return fmt.Errorf("LoadBalancer service ingress at index %d reports error: %s", ix, *ingressPortStatus.Error)
+			return nil, fmt.Errorf("LoadBalancer service ingress at index %d reports error: %s", ix, *ingressPortStatus.Error)
 		}
 		port := ingressPortStatus.Port
 		if port == 0 {
-			return fmt.Errorf("LoadBalancer servce ingress at index %d has no port assigned", ix)
+			return nil, fmt.Errorf("LoadBalancer servce ingress at index %d has no port assigned", ix)
 		}
+		addresses = append(addresses, net.JoinHostPort(hostname, strconv.Itoa(int(port))))
+	}
+	return addresses, nil
+}
 
-		loadBalancerURL := fmt.Sprintf("http://%s:%d/rwx/%s", hostname, port, cfg.MergedValues.TestFile.Name)
-		resp, err := cfg.HTTP.Get(loadBalancerURL)
-		err = testURL(fmt.Sprintf("GET RWX LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, cfg.MergedValues.TestFile.Contents)
+func TestLoadBalancer(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
+	addresses, err := loadBalancerAddresses(statefulSetService)
+	if err != nil {
+		return err
+	}
+	path, expectedBody := cfg.testFilePath()
+	for ix, address := range addresses {
+		loadBalancerURL := fmt.Sprintf("http://%s%s", address, path)
+		resp, err := httpGet(ctx, cfg.HTTP, loadBalancerURL)
+		err = testURL(ctx, fmt.Sprintf("GET LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, expectedBody)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		loadBalancerURL = fmt.Sprintf("http://%s:%d/rwo/%s", hostname, port, cfg.MergedValues.TestFile.Name)
-		resp, err = cfg.HTTP.Post(loadBalancerURL, "application/octet-stream", bytes.NewBuffer([]byte(cfg.MergedValues.TestFile.Contents)))
-		err = testURL(fmt.Sprintf("POST RWO LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, "")
+// TestRWO writes the test file to the StatefulSet's RWO volume through its LoadBalancer, then reads it back
+func TestRWO(ctx context.Context, cfg *Config, statefulSetService *corev1.Service) error {
+	addresses, err := loadBalancerAddresses(statefulSetService)
+	if err != nil {
+		return err
+	}
+	for ix, address := range addresses {
+		loadBalancerURL := fmt.Sprintf("http://%s/rwo/%s", address, cfg.MergedValues.TestFile.Name)
+		resp, err := httpPost(ctx, cfg.HTTP, loadBalancerURL, "application/octet-stream", bytes.NewBuffer([]byte(cfg.MergedValues.TestFile.Contents)))
+		err = testURL(ctx, fmt.Sprintf("POST RWO LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, "")
 		if err != nil {
 			return err
 		}
 
-		loadBalancerURL = fmt.Sprintf("http://%s:%d/rwo/%s", hostname, port, cfg.MergedValues.TestFile.Name)
-		resp, err = cfg.HTTP.Get(loadBalancerURL)
-		err = testURL(fmt.Sprintf("GET RWO LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, cfg.MergedValues.TestFile.Contents)
+		resp, err = httpGet(ctx, cfg.HTTP, loadBalancerURL)
+		err = testURL(ctx, fmt.Sprintf("GET RWO LoadBalancer ingress index %d", ix), loadBalancerURL, resp, err, cfg.MergedValues.TestFile.Contents)
 		if err != nil {
 			return err
 		}
@@ -279,69 +518,331 @@ func TestLoadBalancer(ctx context.Context, cfg *Config, statefulSetService *core
 	return nil
 }
 
+// TestRWX checks that the Job which writes the test file to the RWX volume completed successfully
+func TestRWX(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string) error {
+	job, err := k8sClient.BatchV1().Jobs(cfg.ReleaseNamespace).Get(ctx, fullname, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "Failed to get RWX Job")
+	}
+	if job.Status.Succeeded != 0 {
+		return nil
+	}
+	if job.Status.Failed != 0 {
+		return fmt.Errorf("RWX Job %s failed to write the test file", job.Name)
+	}
+	return fmt.Errorf("RWX Job %s has not completed", job.Name)
+}
+
+// TestLogs streams the logs of a pod, up to LogsMaxBytes and for up to LogsMaxDuration
 func TestLogs(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, pod *corev1.Pod, dest io.Writer) error {
-	logs, err := k8sClient.CoreV1().Pods(cfg.ReleaseNamespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(ctx)
+	logOpts := &corev1.PodLogOptions{}
+	if cfg.LogsMaxBytes != 0 {
+		logOpts.LimitBytes = &cfg.LogsMaxBytes
+	}
+	logsCtx := ctx
+	if cfg.LogsMaxDuration != 0 {
+		var cancel context.CancelFunc
+		logsCtx, cancel = context.WithTimeout(ctx, cfg.LogsMaxDuration)
+		defer cancel()
+	}
+	logs, err := k8sClient.CoreV1().Pods(cfg.ReleaseNamespace).GetLogs(pod.Name, logOpts).Stream(logsCtx)
 	if err != nil {
 		return errors.Wrap(err, "Failed to start streaming pod logs")
 	}
 	defer logs.Close()
 	_, err = io.Copy(dest, logs)
+	if err != nil && ctx.Err() == nil && logsCtx.Err() != nil {
+		log.Printf("Stopped streaming logs of pod %s after %s", pod.Name, cfg.LogsMaxDuration)
+		return nil
+	}
 	if err != nil {
 		return errors.Wrap(err, "Failed to stream logs")
 	}
 	return nil
 }
 
-func Test(ctx context.Context, cfg *Config) error {
-	k8sClient, err := cfg.K8sClient()
-	if err != nil {
-		return errors.Wrap(err, "Failed to create Kubernetes client")
+// TestLogsPods streams the logs of each of a set of pods in turn
+func TestLogsPods(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, pods []corev1.Pod, dest io.Writer) error {
+	for ix := range pods {
+		err := TestLogs(ctx, cfg, k8sClient, &pods[ix], dest)
+		if err != nil {
+			return errors.Wrapf(err, "Logs of pod %s on node %s failed", pods[ix].Name, pods[ix].Spec.NodeName)
+		}
 	}
+	return nil
+}
+
+// Names of the built-in checks
+const (
+	CheckPortForward            = "port-forward"
+	CheckPortForwardService     = "port-forward-service"
+	CheckPortForwardStatefulSet = "port-forward-statefulset"
+	CheckIngress                = "ingress"
+	CheckIngressTLS             = "ingress-tls"
+	CheckIngressEcho            = "ingress-echo"
+	CheckNodePort               = "nodeport"
+	CheckLoadBalancer           = "loadbalancer"
+	CheckLoadBalancerSourceIP   = "loadbalancer-source-ip"
+	CheckNodePortLocal          = "nodeport-local"
+	CheckLogs                   = "logs"
+	CheckRWO                    = "rwo"
+	CheckRWX                    = "rwx"
+	CheckDNS                    = "dns"
+	CheckConnectivityMatrix     = "connectivity-matrix"
+)
 
-	fullname := cfg.Fullname()
+func init() {
+	DefaultRegistry.MustRegister(
+		NewCheck(CheckRWX, func(ctx context.Context, env *Env) error {
+			log.Print("Testing RWX Volume...")
+			return TestRWX(ctx, env.Config, env.K8sClient, env.Fullname)
+		}),
+		NewCheck(CheckPortForward, func(ctx context.Context, env *Env) error {
+			if env.Config.PerNode {
+				log.Println("Finding pods to port-forward on each node...")
+				nodePods, err := env.NodePods(ctx)
+				if err != nil {
+					return err
+				}
+				log.Printf("Found pods to port-forward on %d nodes...", len(nodePods))
+				RecordDetail(ctx, "nodes", fmt.Sprintf("%d", len(nodePods)))
+
+				log.Printf("Testing Port-Forwarding...")
+				return TestPortForwardPods(ctx, env.Config, nodePods)
+			}
+			if env.Config.PortForwardAllReplicas {
+				log.Println("Finding pods to port-forward...")
+				deploymentPods, err := env.DeploymentPods(ctx)
+				if err != nil {
+					return err
+				}
+				log.Printf("Found %d pods to port-forward...", len(deploymentPods))
+
+				log.Printf("Testing Port-Forwarding...")
+				return TestPortForwardPods(ctx, env.Config, deploymentPods)
+			}
+			log.Println("Finding pod to port-forward...")
+			deploymentPod, err := env.DeploymentPod(ctx)
+			if err != nil {
+				return err
+			}
+			log.Printf("Found pod %s to port-forward...", deploymentPod.Name)
+
+			log.Printf("Testing Port-Forwarding...")
+			return TestPortForward(ctx, env.Config, deploymentPod)
+		}),
+		NewCheck(CheckPortForwardService, func(ctx context.Context, env *Env) error {
+			log.Printf("Testing Port-Forwarding to Service...")
+			return TestPortForwardService(ctx, env.Config, env.K8sClient, env.Fullname)
+		}),
+		NewCheck(CheckPortForwardStatefulSet, func(ctx context.Context, env *Env) error {
+			log.Printf("Testing Port-Forwarding to StatefulSet...")
+			return TestPortForwardStatefulSet(ctx, env.Config, env.Fullname)
+		}),
+		NewCheck(CheckIngress, func(ctx context.Context, env *Env) error {
+			ingressClient, err := env.IngressClient()
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Testing Ingress...")
+			return TestIngress(ctx, env.Config, ingressClient)
+		}),
+		NewCheck(CheckIngressTLS, func(ctx context.Context, env *Env) error {
+			ingressClient, err := env.IngressClient()
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Testing Ingress TLS certificate...")
+			return TestIngressTLS(ctx, env.Config, env.K8sClient, ingressClient)
+		}, CheckIngress),
+		NewCheck(CheckIngressEcho, func(ctx context.Context, env *Env) error {
+			ingressClient, err := env.IngressClient()
+			if err != nil {
+				return err
+			}
+			deploymentPods, err := env.DeploymentPods(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Testing Ingress request metadata...")
+			return TestIngressEcho(ctx, env.Config, ingressClient, deploymentPods)
+		}, CheckIngress),
+		NewCheck(CheckNodePort, func(ctx context.Context, env *Env) error {
+			log.Printf("Getting StatefulSet Service...")
+			statefulSetService, err := env.StatefulSetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing NodePort...")
+			return TestNodePort(ctx, env.Config, statefulSetService)
+		}),
+		NewCheck(CheckLoadBalancer, func(ctx context.Context, env *Env) error {
+			log.Printf("Getting StatefulSet Service...")
+			statefulSetService, err := env.StatefulSetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing LoadBalancer...")
+			return TestLoadBalancer(ctx, env.Config, statefulSetService)
+		}),
+		NewCheck(CheckLoadBalancerSourceIP, func(ctx context.Context, env *Env) error {
+			statefulSetService, err := env.StatefulSetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing LoadBalancer source IP preservation...")
+			return TestLoadBalancerSourceIP(ctx, env.Config, statefulSetService)
+		}, CheckLoadBalancer),
+		NewCheck(CheckNodePortLocal, func(ctx context.Context, env *Env) error {
+			statefulSetService, err := env.StatefulSetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing NodePort with externalTrafficPolicy Local on each node...")
+			return TestNodePortLocal(ctx, env.Config, env.K8sClient, statefulSetService, env.Fullname)
+		}, CheckNodePort),
+		NewCheck(CheckRWO, func(ctx context.Context, env *Env) error {
+			statefulSetService, err := env.StatefulSetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing RWO Volume...")
+			return TestRWO(ctx, env.Config, statefulSetService)
+		}, CheckLoadBalancer),
+		NewCheck(CheckLogs, func(ctx context.Context, env *Env) error {
+			if env.Config.PerNode {
+				nodePods, err := env.NodePods(ctx)
+				if err != nil {
+					return err
+				}
+				RecordDetail(ctx, "nodes", fmt.Sprintf("%d", len(nodePods)))
+
+				log.Printf("Testing Logs on %d nodes...", len(nodePods))
+				return TestLogsPods(ctx, env.Config, env.K8sClient, nodePods, os.Stderr)
+			}
+			deploymentPod, err := env.DeploymentPod(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing Logs...")
+			return TestLogs(ctx, env.Config, env.K8sClient, deploymentPod, os.Stderr)
+		}),
+		NewCheck(CheckDNS, func(ctx context.Context, env *Env) error {
+			deploymentPod, err := env.DeploymentPod(ctx)
+			if err != nil {
+				return err
+			}
+
+			log.Print("Testing DNS...")
+			return TestDNS(ctx, env.Config, env.K8sClient, env.Fullname, deploymentPod)
+		}),
+		NewCheck(CheckConnectivityMatrix, func(ctx context.Context, env *Env) error {
+			log.Print("Testing connectivity between the DaemonSet pods on each node...")
+			return TestConnectivityMatrix(ctx, env.Config, env.K8sClient, env.Fullname)
+		}),
+	)
+}
 
-	log.Println("Finding pod to port-forward...")
-	deploymentPod, err := cfg.PickDeploymentPod(ctx, k8sClient, fullname)
+// Test executes every check in the configured registry, in dependency order.
+// If WaitTimeout is set, the release is first waited for, and its outcome is the first result of the report.
+// Up to Parallelism checks are executed at once, each only after its dependencies have finished.
+// Unless ContinueOnFailure is set, no further checks are started after the first failure.
+// If Events is set, the events involving the release while the checks executed are the last result of the report.
+// If any check failed and DiagnosticsPath is set, a diagnostic bundle is written there.
+// The returned error is either the first check failure, or an error that prevented any checks from being executed.
+func Test(ctx context.Context, cfg *Config) (*Report, error) {
+	report := &Report{Start: time.Now()}
+	defer func() { report.Duration = time.Since(report.Start) }()
+
+	registry := cfg.Registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	checks, err := registry.Checks()
 	if err != nil {
-		return err
+		return report, err
 	}
-	log.Printf("Found pod %s to port-forward...", deploymentPod.Name)
 
-	log.Printf("Testing Port-Forwarding...")
-	err = TestPortForward(ctx, cfg, deploymentPod)
-	if err != nil {
-		return err
+	names := append(append([]string{}, cfg.Only...), cfg.Skip...)
+	for name := range cfg.CheckRetry {
+		names = append(names, name)
+	}
+	for name := range cfg.CheckTimeouts {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := registry.Get(name); !ok {
+			return report, fmt.Errorf("No check named %s is registered", name)
+		}
 	}
 
-	log.Printf("Testing Ingress...")
-	err = TestIngress(ctx, cfg)
-	if err != nil {
-		return err
+	switch cfg.Events {
+	case "", EventsOff, EventsWarn, EventsFail:
+	default:
+		return report, fmt.Errorf("Unsupported events mode %s, must be one of %v", cfg.Events, EventsModes)
 	}
 
-	log.Printf("Getting StatefulSet Service...")
-	statefulSetService, err := cfg.GetStatefulSetService(ctx, k8sClient, fullname)
+	env, err := NewEnv(cfg)
 	if err != nil {
-		return err
+		return report, err
 	}
 
-	log.Print("Testing NodePort...")
-	err = TestNodePort(ctx, cfg, statefulSetService)
-	if err != nil {
-		return err
+	notReady := false
+	if cfg.WaitTimeout != 0 {
+		result := &Result{Name: ResultReady, Start: time.Now()}
+		report.Results = append(report.Results, result)
+		log.Printf("Waiting up to %s for the release to be ready...", cfg.WaitTimeout)
+		err = WaitForReady(withResult(ctx, result), cfg, env.K8sClient, env.Fullname, cfg.WaitTimeout)
+		result.Duration = time.Since(result.Start)
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err
+			notReady = true
+		} else {
+			result.Status = StatusPassed
+		}
 	}
 
-	log.Print("Testing LoadBalancer...")
-	err = TestLoadBalancer(ctx, cfg, statefulSetService)
-	if err != nil {
-		return err
+	var events *eventWatcher
+	var eventsResult *Result
+	switch {
+	case cfg.Events == "" || cfg.Events == EventsOff:
+	case notReady:
+		eventsResult = &Result{Name: ResultEvents, Status: StatusSkipped, SkipReason: "Release was not ready"}
+	default:
+		events, err = watchEvents(ctx, cfg, env.K8sClient, env.Fullname)
+		if err != nil {
+			eventsResult = &Result{Name: ResultEvents, Start: time.Now(), Status: StatusFailed, Error: err}
+		}
 	}
 
-	log.Print("Testing Logs...")
-	err = TestLogs(ctx, cfg, k8sClient, deploymentPod, os.Stdout)
-	if err != nil {
-		return err
+	report.Results = append(report.Results, runChecks(ctx, env, checks, notReady)...)
+
+	if events != nil {
+		eventsResult = events.stop(cfg.Events)
+	}
+	if eventsResult != nil {
+		report.Results = append(report.Results, eventsResult)
 	}
 
-	return nil
+	if cfg.DiagnosticsPath != "" && !report.Passed() {
+		log.Printf("Collecting diagnostics to %s...", cfg.DiagnosticsPath)
+		diagErr := CollectDiagnostics(ctx, cfg, env.K8sClient, report, cfg.DiagnosticsPath)
+		if diagErr != nil {
+			log.Printf("Failed to collect diagnostics: %s", diagErr)
+		} else {
+			report.DiagnosticsPath = cfg.DiagnosticsPath
+		}
+	}
+
+	return report, report.Err()
 }
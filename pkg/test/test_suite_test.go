@@ -0,0 +1,14 @@
+package test
+
+import (
+	"testing"
+
+	// Ginkgo is not dot-imported, as its Report would conflict with this package's
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTest(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Test Suite")
+}
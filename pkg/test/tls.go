@@ -0,0 +1,114 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ingressUsesTLS returns true if the ingress should be contacted over HTTPS
+func (cfg *Config) ingressUsesTLS() bool {
+	return cfg.IngressTLS || len(cfg.MergedValues.Deployment.Ingress.TLS) != 0
+}
+
+// ingressTLSSecretName returns the name of the secret containing the certificate for the ingress hostname, or an empty string if none is configured
+func (cfg *Config) ingressTLSSecretName() string {
+	ingress := cfg.MergedValues.Deployment.Ingress
+	for _, tls := range ingress.TLS {
+		// The chart uses the ingress hostname if hosts is not set
+		if len(tls.Hosts) == 0 || containsString(tls.Hosts, ingress.Hostname) {
+			return tls.SecretName
+		}
+	}
+	return ""
+}
+
+// TestIngressTLS checks that the certificate served by the ingress is valid for the ingress hostname, and has not expired.
+// This catches ingress controllers falling back to a default certificate when the configured one is missing or invalid.
+// If IngressTLSCompareSecret is set, the certificate must also be the one in the secret referenced by deployment.ingress.tls.
+func TestIngressTLS(ctx context.Context, cfg *Config, k8sClient kubernetes.Interface, client *http.Client) error {
+	hostname := cfg.MergedValues.Deployment.Ingress.Hostname
+	ingressURL := fmt.Sprintf("https://%s/health", cfg.ingressURLHost())
+	RecordURL(ctx, ingressURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ingressURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = hostname
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to connect to Ingress %s", ingressURL)
+	}
+	resp.Body.Close()
+	RecordResponse(ctx, ingressURL, resp)
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return fmt.Errorf("Ingress %s did not present a certificate", ingressURL)
+	}
+	chain := resp.TLS.PeerCertificates
+	leaf := chain[0]
+	RecordDetail(ctx, "subject", leaf.Subject.String())
+	RecordDetail(ctx, "issuer", leaf.Issuer.String())
+	RecordDetail(ctx, "notAfter", leaf.NotAfter.Format(time.RFC3339))
+
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("Ingress certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	err = leaf.VerifyHostname(hostname)
+	if err != nil {
+		return errors.Wrapf(err, "Ingress certificate (subject %s, issuer %s) is not valid for %s", leaf.Subject, leaf.Issuer, hostname)
+	}
+
+	// The HTTP client has already verified the chain, but possibly against a different server name,
+	// so verify it again against the ingress hostname, unless verification is disabled
+	transport, err := cloneTransport(client)
+	if err != nil {
+		return err
+	}
+	if transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       hostname,
+			Intermediates: intermediates,
+		}
+		if transport.TLSClientConfig != nil {
+			opts.Roots = transport.TLSClientConfig.RootCAs
+		}
+		_, err = leaf.Verify(opts)
+		if err != nil {
+			return errors.Wrapf(err, "Ingress certificate (subject %s, issuer %s) is not trusted", leaf.Subject, leaf.Issuer)
+		}
+	}
+
+	if !cfg.IngressTLSCompareSecret {
+		return nil
+	}
+	secretName := cfg.ingressTLSSecretName()
+	if secretName == "" {
+		return fmt.Errorf("No secretName is set in deployment.ingress.tls for %s to compare the ingress certificate to", hostname)
+	}
+	secret, err := k8sClient.CoreV1().Secrets(cfg.ReleaseNamespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get ingress TLS secret %s", secretName)
+	}
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return fmt.Errorf("Ingress TLS secret %s has no PEM certificate in %s", secretName, corev1.TLSCertKey)
+	}
+	if !bytes.Equal(block.Bytes, leaf.Raw) {
+		return fmt.Errorf("Ingress certificate (subject %s, issuer %s) is not the certificate in secret %s", leaf.Subject, leaf.Issuer, secretName)
+	}
+	return nil
+}
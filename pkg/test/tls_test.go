@@ -0,0 +1,196 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testCA is a certificate authority which issues certificates for test TLS servers
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// issue creates a server certificate for a hostname which expires at notAfter
+func (ca *testCA) issue(hostname string, notAfter time.Time) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    notAfter.Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).ToNot(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// certPEM encodes the leaf of a certificate as it would be stored in a kubernetes.io/tls secret
+func certPEM(cert tls.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+}
+
+var _ = ginkgo.Describe("TestIngressTLS", func() {
+	const hostname = "smoke.example.com"
+
+	var ca *testCA
+	var serverCert tls.Certificate
+
+	ginkgo.BeforeEach(func() {
+		ca = newTestCA()
+		serverCert = ca.issue(hostname, time.Now().Add(time.Hour))
+	})
+
+	// serveTLS starts an ingress serving cert, and returns the config and client to test it with,
+	// which trusts roots and connects as the test would with --ingress-hostname set to the server address
+	serveTLS := func(cert tls.Certificate, roots *x509.CertPool, valuesHostname string, insecure bool) (*Config, *http.Client) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		srv.StartTLS()
+		ginkgo.DeferCleanup(srv.Close)
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, InsecureSkipVerify: insecure}
+		cfg := &Config{
+			HTTP:             &http.Client{Transport: transport},
+			IngressHostname:  srv.Listener.Addr().String(),
+			ReleaseNamespace: "default",
+			MergedValues:     &MergedValues{},
+		}
+		cfg.MergedValues.Deployment.Ingress.Hostname = valuesHostname
+		client, err := cfg.ingressClient()
+		Expect(err).ToNot(HaveOccurred())
+		return cfg, client
+	}
+
+	ginkgo.It("should accept a trusted certificate for the ingress hostname", func(ctx ginkgo.SpecContext) {
+		cfg, client := serveTLS(serverCert, ca.pool(), hostname, false)
+		Expect(TestIngressTLS(ctx, cfg, fake.NewSimpleClientset(), client)).To(Succeed())
+	})
+
+	ginkgo.It("should reject a certificate for another hostname", func(ctx ginkgo.SpecContext) {
+		cfg, client := serveTLS(serverCert, ca.pool(), "other.example.com", false)
+		Expect(TestIngressTLS(ctx, cfg, fake.NewSimpleClientset(), client)).To(MatchError(ContainSubstring("Failed to connect to Ingress")))
+	})
+
+	ginkgo.It("should reject a certificate for another hostname when verification is disabled", func(ctx ginkgo.SpecContext) {
+		cfg, client := serveTLS(serverCert, nil, "other.example.com", true)
+		Expect(TestIngressTLS(ctx, cfg, fake.NewSimpleClientset(), client)).To(MatchError(ContainSubstring("is not valid for other.example.com")))
+	})
+
+	ginkgo.It("should reject a certificate from an untrusted CA", func(ctx ginkgo.SpecContext) {
+		cfg, client := serveTLS(serverCert, newTestCA().pool(), hostname, false)
+		Expect(TestIngressTLS(ctx, cfg, fake.NewSimpleClientset(), client)).To(MatchError(ContainSubstring("Failed to connect to Ingress")))
+	})
+
+	ginkgo.It("should reject an expired certificate when verification is disabled", func(ctx ginkgo.SpecContext) {
+		cfg, client := serveTLS(ca.issue(hostname, time.Now().Add(-time.Hour)), nil, hostname, true)
+		Expect(TestIngressTLS(ctx, cfg, fake.NewSimpleClientset(), client)).To(MatchError(ContainSubstring("Ingress certificate expired")))
+	})
+
+	ginkgo.Describe("comparing the certificate to the secret", func() {
+		secret := func(name string, cert []byte) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{corev1.TLSCertKey: cert},
+			}
+		}
+
+		ginkgo.DescribeTable("secret contents",
+			func(ctx ginkgo.SpecContext, tlsValues []DeploymentIngressTLSValues, secrets func() []*corev1.Secret, expectedErr string) {
+				cfg, client := serveTLS(serverCert, ca.pool(), hostname, false)
+				cfg.IngressTLSCompareSecret = true
+				cfg.MergedValues.Deployment.Ingress.TLS = tlsValues
+				k8sClient := fake.NewSimpleClientset()
+				for _, secret := range secrets() {
+					_, err := k8sClient.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+					Expect(err).ToNot(HaveOccurred())
+				}
+				err := TestIngressTLS(ctx, cfg, k8sClient, client)
+				if expectedErr == "" {
+					Expect(err).ToNot(HaveOccurred())
+				} else {
+					Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				}
+			},
+			ginkgo.Entry("the served certificate",
+				[]DeploymentIngressTLSValues{{SecretName: "smoke-tls", Hosts: []string{hostname}}},
+				func() []*corev1.Secret { return []*corev1.Secret{secret("smoke-tls", certPEM(serverCert))} },
+				"",
+			),
+			ginkgo.Entry("the served certificate, with hosts defaulted to the ingress hostname",
+				[]DeploymentIngressTLSValues{{SecretName: "smoke-tls"}},
+				func() []*corev1.Secret { return []*corev1.Secret{secret("smoke-tls", certPEM(serverCert))} },
+				"",
+			),
+			ginkgo.Entry("another certificate for the same hostname",
+				[]DeploymentIngressTLSValues{{SecretName: "smoke-tls"}},
+				func() []*corev1.Secret {
+					return []*corev1.Secret{secret("smoke-tls", certPEM(ca.issue(hostname, time.Now().Add(time.Hour))))}
+				},
+				"is not the certificate in secret smoke-tls",
+			),
+			ginkgo.Entry("no PEM certificate",
+				[]DeploymentIngressTLSValues{{SecretName: "smoke-tls"}},
+				func() []*corev1.Secret { return []*corev1.Secret{secret("smoke-tls", []byte("not a certificate"))} },
+				"has no PEM certificate",
+			),
+			ginkgo.Entry("missing secret",
+				[]DeploymentIngressTLSValues{{SecretName: "smoke-tls"}},
+				func() []*corev1.Secret { return nil },
+				"Failed to get ingress TLS secret smoke-tls",
+			),
+			ginkgo.Entry("no secret for the ingress hostname",
+				[]DeploymentIngressTLSValues{{SecretName: "other-tls", Hosts: []string{"other.example.com"}}},
+				func() []*corev1.Secret { return []*corev1.Secret{secret("other-tls", certPEM(serverCert))} },
+				"No secretName is set",
+			),
+		)
+	})
+})
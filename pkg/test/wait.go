@@ -0,0 +1,230 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResultReady is the name of the result recorded for waiting for the release to be ready, if Config.WaitTimeout is set
+const ResultReady = "ready"
+
+// waitInterval is how often the resources of the release are checked while waiting for them to be ready
+const waitInterval = 2 * time.Second
+
+// readiness checks whether a single resource of the release is ready
+type readiness struct {
+	// resource is the kind and name of the resource, for reporting
+	resource string
+	// check returns why the resource is not ready, or an empty string if it is.
+	// An error indicates the resource will never become ready, e.g. a failed Job.
+	check func(ctx context.Context) (reason string, err error)
+}
+
+// notReadyReason converts the error from getting a resource into a reason it is not ready
+func notReadyReason(err error) string {
+	if apierrors.IsNotFound(err) {
+		return "does not exist"
+	}
+	return fmt.Sprintf("could not be fetched: %s", err)
+}
+
+// readinesses returns the resources of the release which must be ready before the checks can pass.
+// The DaemonSet, ingress and load balancer status are only waited for if their checks will be executed.
+func (cfg *Config) readinesses(k8sClient *kubernetes.Clientset, fullname string) []readiness {
+	ns := cfg.ReleaseNamespace
+	readinesses := []readiness{
+		{
+			resource: "Deployment " + fullname,
+			check: func(ctx context.Context) (string, error) {
+				deployment, err := k8sClient.AppsV1().Deployments(ns).Get(ctx, fullname, metav1.GetOptions{})
+				if err != nil {
+					return notReadyReason(err), nil
+				}
+				replicas := int32(1)
+				if deployment.Spec.Replicas != nil {
+					replicas = *deployment.Spec.Replicas
+				}
+				status := deployment.Status
+				if status.ObservedGeneration < deployment.Generation {
+					return "latest spec has not been observed", nil
+				}
+				if status.UpdatedReplicas != replicas || status.Replicas != replicas {
+					return fmt.Sprintf("%d/%d replicas updated, %d total", status.UpdatedReplicas, replicas, status.Replicas), nil
+				}
+				if status.ReadyReplicas != replicas {
+					return fmt.Sprintf("%d/%d replicas ready", status.ReadyReplicas, replicas), nil
+				}
+				return "", nil
+			},
+		},
+		{
+			resource: "StatefulSet " + fullname,
+			check: func(ctx context.Context) (string, error) {
+				statefulSet, err := k8sClient.AppsV1().StatefulSets(ns).Get(ctx, fullname, metav1.GetOptions{})
+				if err != nil {
+					return notReadyReason(err), nil
+				}
+				replicas := int32(1)
+				if statefulSet.Spec.Replicas != nil {
+					replicas = *statefulSet.Spec.Replicas
+				}
+				status := statefulSet.Status
+				if status.ObservedGeneration < statefulSet.Generation {
+					return "latest spec has not been observed", nil
+				}
+				if status.UpdatedReplicas != replicas {
+					return fmt.Sprintf("%d/%d replicas updated", status.UpdatedReplicas, replicas), nil
+				}
+				if status.ReadyReplicas != replicas {
+					return fmt.Sprintf("%d/%d replicas ready", status.ReadyReplicas, replicas), nil
+				}
+				return "", nil
+			},
+		},
+	}
+
+	if isEnabled(cfg.MergedValues.Persistence.RWO.Enabled) {
+		readinesses = append(readinesses, cfg.pvcReadiness(k8sClient, fmt.Sprintf("rwo-%s-0", fullname)))
+	}
+	if isEnabled(cfg.MergedValues.Persistence.RWX.Enabled) {
+		readinesses = append(readinesses,
+			cfg.pvcReadiness(k8sClient, fullname+"-rwx"),
+			readiness{
+				resource: "Job " + fullname,
+				check: func(ctx context.Context) (string, error) {
+					job, err := k8sClient.BatchV1().Jobs(ns).Get(ctx, fullname, metav1.GetOptions{})
+					if err != nil {
+						return notReadyReason(err), nil
+					}
+					if job.Status.Succeeded > 0 {
+						return "", nil
+					}
+					for _, condition := range job.Status.Conditions {
+						if condition.Type == "Failed" && condition.Status == corev1.ConditionTrue {
+							return "", fmt.Errorf("Job %s failed: %s: %s", fullname, condition.Reason, condition.Message)
+						}
+					}
+					return fmt.Sprintf("has not completed (%d active, %d failed)", job.Status.Active, job.Status.Failed), nil
+				},
+			},
+		)
+	}
+	if cfg.checkSkipReason(CheckConnectivityMatrix) == "" {
+		readinesses = append(readinesses, readiness{
+			resource: "DaemonSet " + fullname,
+			check: func(ctx context.Context) (string, error) {
+				daemonSet, err := k8sClient.AppsV1().DaemonSets(ns).Get(ctx, fullname, metav1.GetOptions{})
+				if err != nil {
+					return notReadyReason(err), nil
+				}
+				status := daemonSet.Status
+				if status.ObservedGeneration < daemonSet.Generation {
+					return "latest spec has not been observed", nil
+				}
+				if status.UpdatedNumberScheduled != status.DesiredNumberScheduled {
+					return fmt.Sprintf("%d/%d pods updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled), nil
+				}
+				if status.NumberReady != status.DesiredNumberScheduled {
+					return fmt.Sprintf("%d/%d pods ready", status.NumberReady, status.DesiredNumberScheduled), nil
+				}
+				return "", nil
+			},
+		})
+	}
+	if cfg.checkSkipReason(CheckIngress) == "" {
+		readinesses = append(readinesses, readiness{
+			resource: "Ingress " + fullname,
+			check: func(ctx context.Context) (string, error) {
+				ingress, err := k8sClient.NetworkingV1().Ingresses(ns).Get(ctx, fullname, metav1.GetOptions{})
+				if err != nil {
+					return notReadyReason(err), nil
+				}
+				if len(ingress.Status.LoadBalancer.Ingress) == 0 {
+					return "has no addresses in its status", nil
+				}
+				return "", nil
+			},
+		})
+	}
+	if cfg.checkSkipReason(CheckLoadBalancer) == "" {
+		serviceName := fullname + "-statefulset"
+		readinesses = append(readinesses, readiness{
+			resource: "Service " + serviceName,
+			check: func(ctx context.Context) (string, error) {
+				service, err := k8sClient.CoreV1().Services(ns).Get(ctx, serviceName, metav1.GetOptions{})
+				if err != nil {
+					return notReadyReason(err), nil
+				}
+				if len(service.Status.LoadBalancer.Ingress) == 0 {
+					return "has no load balancer ingresses in its status", nil
+				}
+				return "", nil
+			},
+		})
+	}
+	return readinesses
+}
+
+func (cfg *Config) pvcReadiness(k8sClient *kubernetes.Clientset, name string) readiness {
+	return readiness{
+		resource: "PersistentVolumeClaim " + name,
+		check: func(ctx context.Context) (string, error) {
+			pvc, err := k8sClient.CoreV1().PersistentVolumeClaims(cfg.ReleaseNamespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return notReadyReason(err), nil
+			}
+			if pvc.Status.Phase != corev1.ClaimBound {
+				return fmt.Sprintf("is %s, not Bound", pvc.Status.Phase), nil
+			}
+			return "", nil
+		},
+	}
+}
+
+// WaitForReady waits until the Deployment, StatefulSet, DaemonSet, Job, PVCs, Ingress and LoadBalancer Service of the release are ready, or the timeout passes.
+// If it times out, the error names every resource which was not ready and why, and each is also recorded as a detail of the result in ctx.
+func WaitForReady(ctx context.Context, cfg *Config, k8sClient *kubernetes.Clientset, fullname string, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pending := cfg.readinesses(k8sClient, fullname)
+	var reasons []string
+	for {
+		notReady := pending[:0]
+		reasons = reasons[:0]
+		for _, r := range pending {
+			reason, err := r.check(waitCtx)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				log.Printf("%s is ready", r.resource)
+				continue
+			}
+			notReady = append(notReady, r)
+			reasons = append(reasons, fmt.Sprintf("%s %s", r.resource, reason))
+		}
+		pending = notReady
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			for ix, r := range pending {
+				RecordDetail(ctx, r.resource, reasons[ix])
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("Release was not ready after %s: %s", timeout, strings.Join(reasons, "; "))
+		case <-time.After(waitInterval):
+		}
+	}
+}